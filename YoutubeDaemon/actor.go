@@ -1,134 +1,735 @@
 package daemon
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"net/http"
+	"io"
+	"maps"
 	"slices"
 	"sync"
 	"time"
 	"ytt/YoutubeDaemon/yt"
-
-	"github.com/ebitengine/oto/v3"
-	"github.com/jfbus/httprs"
 )
 
-type Event any
-
-type EventTrackStarted Track
-type EventErr = error
-type EventInfo = string
-
 type Command any
 type CmdStop struct{}
+type CmdPause struct{}  // keeps the stream and decode position
+type CmdResume struct{} // resume a paused track
+type CmdTogglePause struct{}
+type CmdSetVolume struct{ Volume int } // percent, 0-100
+type CmdChangeVolume struct{ Delta int }
+type CmdSetMuted struct{ Muted bool }
+type CmdToggleMute struct{}
+type CmdSetShuffle struct{ Shuffle bool }
+type CmdToggleShuffle struct{}
+type CmdSetShuffleSeed struct{ Seed uint64 }
+type CmdSetRepeat struct{ Repeat RepeatMode }
+type CmdCycleRepeat struct{} // off -> all -> one -> off
+type CmdSeek struct {
+	Offset   time.Duration
+	Absolute bool // seek to Offset from the start instead of relative to the current position
+}
 type CmdPlayNextTrack struct{}
-type CmdFetchStreamURL struct{ *Track }
+type CmdPlayPreviousTrack struct{}
+type CmdTrackEnded struct { // sent by the mixer once it is done with a reader
+	reader *Reader
+	next   *Reader // the queued reader the mixer went on with, if any
+	fading bool    // reader is still fading out under next
+}
+type CmdSetCrossfade struct{ Duration time.Duration } // 0 is gapless
+type CmdSetSink struct{ Open SinkOpener }
+type CmdSetEqualizer struct{ Enabled bool }
+type CmdToggleEqualizer struct{}
+type CmdSetEqualizerPreset struct{ Preset string }
+type CmdSetSpeed struct{ Speed float64 }
+type CmdChangeSpeed struct{ Delta float64 }
+type CmdSetDefaultSpeeds struct {
+	Default   float64
+	Playlists map[string]float64 // by playlist id
+}
+type CmdSleepTimer struct{ Duration time.Duration } // 0 turns the sleep timer off
+type CmdStopAfter struct{ Tracks int }              // 1 is the track playing now, 0 turns it off
+type CmdSetNormalization struct {
+	Mode   NormalizationMode
+	Target float64 // LUFS
+}
 type CmdPlayTrack struct{ *Track }
+type CmdCancelLoad struct{}
+type CmdTrackLoaded struct { // sent by loadTrack
+	ctx    context.Context
+	url    string
+	reader *Reader
+	err    error
+}
 type CmdSetQueue struct{ Tracks []*Track }
+type CmdAddToQueue struct{ Tracks []*Track }
+type CmdQueueNext struct{ Tracks []*Track } // insert right after the current track
+type CmdRemoveFromQueue struct{ Index int }
+type CmdMoveInQueue struct{ From, To int }
+type CmdClearQueue struct{}
 type CmdGetQueue struct{ queue chan<- []*Track }
 type CmdStartQueue struct{}               // start playing queue
 type CmdSetQueuePosition struct{ *Track } // set queue to start from here
+type CmdPlayFromQueue struct{ Index int } // jump to the track at Index and play it
 type CmdRegisterPlaylists struct{ playlistIDs []string }
+type CmdRegisterFolders struct{ paths []string }
+type CmdRegisterStreams struct{ urls []string }
+type CmdFolderScanned struct { // sent by scanFolders
+	dir      string
+	playlist Playlist
+	skipped  []string // audio files in formats the player can't decode
+	err      error
+}
 type CmdGetRegisteredPlaylists struct{ playlists chan<- []Playlist }
 type CmdGetCurrentTrackDuration struct{ duration chan<- time.Duration }
+type CmdProgressTick struct{} // sent by progressTicker
+type CmdSetPrefetch struct{ Tracks int }
+type CmdStreamURLResolved struct { // sent by resolveStreamURL
+	track *Track
+	url   string
+	err   error
+}
+
+// how often EventProgress is sent
+const progressInterval = 250 * time.Millisecond
+
+// how long the volume fades out before the sleep timer stops playback
+const sleepFade = 30 * time.Second
 
 var cmdCh chan Command
-var events chan Event
 
 func InitDaemon() {
-	<-yt.Ready
 	cmdCh = make(chan Command)
-	events = make(chan Event)
-	go playerManager(cmdCh, events)
-}
-func Events() <-chan Event {
-	return events
+	go playerManager(cmdCh)
+	go progressTicker()
 }
 
-func playerManager(cmdCh <-chan Command, events chan<- Event) {
+func playerManager(cmdCh <-chan Command) {
 	var (
-		player  *oto.Player
-		cleanup func() //for stopping player
+		player  AudioSink              // plays mix for the whole session
+		newSink SinkOpener             = openOtoSink
+		mix                            = newMixer()
+		reader  *Reader                // reader of the track that is playing
+		cleanup func()                 //for stopping player
+		retired = map[*Reader]func(){} // cleanups of readers still fading out
+		state   PlayerState
+		volume  = 100 // percent
+		muted   bool
 
 		playlists = []Playlist{} // registered playlists
 
-		queue      = []*Track{} // []Track from within a playlist
-		queueIndex int
+		queue = newPlayQueue(uint64(time.Now().UnixNano())) // []Track from within a playlist
 
 		trackPlaying *Track
+		fromQueue    bool       // trackPlaying was started from the queue
+		loading      *trackLoad // track that is being loaded, if any
+
+		prefetchTracks = 1                 // how many upcoming tracks get their stream url resolved
+		crossfade      time.Duration       // the mixer has it, kept to tell when prefetching is off
+		prefetched     *trackLoad          // the next track, opened ahead of time
+		resolving      = map[*Track]bool{} // tracks waiting for resolveStreamURL
+
+		eqEnabled bool
+		eqPreset  = EQPresets[0]
+
+		speed          = 1.0 // of trackPlaying
+		defaultSpeed   = 1.0
+		playlistSpeeds = map[string]float64{}
+
+		sleepAt     time.Time // when the sleep timer goes off, zero if it isn't set by time
+		sleepTracks int       // tracks that end before stopping, 0 if it isn't set by tracks
+		sleepGain   = 1.0     // fades the volume out before sleeping
+
+		normalization  NormalizationMode
+		targetLoudness = -14.0                     // LUFS
+		loudness       = map[string]*yt.Loudness{} // by video id, nil if the track wasn't measured yet
 	)
+	setState := func(s PlayerState) {
+		if state != s {
+			state = s
+			publish(EventStateChanged{s})
+		}
+	}
+	applyVolume := func() {
+		if player == nil {
+			return
+		}
+		if muted {
+			player.SetVolume(0)
+		} else {
+			player.SetVolume(float64(volume) / 100 * sleepGain)
+		}
+	}
+	setVolume := func(v int, m bool) {
+		volume, muted = max(0, min(v, 100)), m
+		applyVolume()
+		publish(EventVolumeChanged{volume, muted})
+	}
+	var prefetch func()
+	queueChanged := func() {
+		publish(EventQueueChanged{slices.Clone(queue.tracks), queue.index(), queue.upcoming()})
+		prefetch()
+	}
+	stop := func() {
+		if cleanup != nil {
+			mix.clear()
+			player.Pause()
+			cleanup()
+			for r, c := range retired {
+				c()
+				delete(retired, r)
+			}
+			cleanup = nil
+			reader = nil
+			setState(StateStopped)
+		}
+	}
+	cancelLoad := func() {
+		if loading != nil {
+			loading.cancel()
+			publish(EventLoadCanceled(*loading.track))
+			loading = nil
+		}
+	}
+	applyEqualizer := func() {
+		if eqEnabled {
+			mix.setEqualizer(newEqualizer(eqPreset))
+		} else {
+			mix.setEqualizer(nil)
+		}
+		publish(EventEqualizerChanged{eqEnabled, eqPreset.Name})
+	}
+	measured := func(t *Track) *yt.Loudness {
+		l, ok := loudness[t.ID]
+		if !ok {
+			if m, found := yt.LoadLoudness(t.ID); found {
+				l = &m
+			}
+			loudness[t.ID] = l
+		}
+		return l
+	}
+	// gainFor is the gain that normalizes t, tracks that were never played
+	// through are left as they are
+	gainFor := func(t *Track) float64 {
+		switch normalization {
+		case NormalizeTrack:
+			if l := measured(t); l != nil {
+				return normalizationGain(*l, targetLoudness)
+			}
+		case NormalizeAlbum:
+			var tracks []yt.Loudness
+			for _, t := range queue.tracks {
+				if l := measured(t); l != nil {
+					tracks = append(tracks, *l)
+				}
+			}
+			if l, ok := albumLoudness(tracks); ok {
+				return normalizationGain(l, targetLoudness)
+			}
+		}
+		return 1
+	}
+	playlistOf := func(t *Track) string {
+		for _, p := range playlists {
+			if slices.Contains(p.Tracks, t) {
+				return p.ID
+			}
+		}
+		return ""
+	}
+	// speedFor is the speed t plays at after trackPlaying. The speed carries
+	// on within a playlist, a track from another one starts at the default
+	// of its playlist.
+	speedFor := func(t *Track) float64 {
+		if trackPlaying != nil && playlistOf(t) == playlistOf(trackPlaying) {
+			return speed
+		}
+		if s, ok := playlistSpeeds[playlistOf(t)]; ok {
+			return s
+		}
+		return defaultSpeed
+	}
+	setSpeed := func(s float64) {
+		s = max(MinSpeed, min(s, MaxSpeed))
+		if s != speed {
+			speed = s
+			publish(EventSpeedChanged{s})
+		}
+		if reader != nil {
+			reader.SetSpeed(s)
+		}
+		if l := prefetched; l != nil && l.loaded != nil && l.loaded.err == nil {
+			l.loaded.reader.SetSpeed(speedFor(l.track))
+		}
+	}
+	// begin makes the loaded track the playing one, the mixer already plays it
+	begin := func(l *trackLoad, loaded CmdTrackLoaded) {
+		t := l.track
+		t.StreamingURL = loaded.url
+		r := loaded.reader
+		publish(EventInfo{fmt.Sprintf("player is playing %s", t.Title)})
+		publish(EventTrackStarted(*t))
+		setState(StatePlaying)
+		trackPlaying = t
+		reader = r
+		if s := r.Speed(); s != speed {
+			speed = s
+			publish(EventSpeedChanged{s})
+		}
+		cleanup = func() {
+			if err := r.Close(); err != nil {
+				publish(EventError{t, fmt.Errorf("closing stream: %w", err)})
+			}
+			l.cancel()
+			if m, ok := r.Loudness(); ok {
+				loudness[t.ID] = &m
+				publish(EventInfo{fmt.Sprintf("%s measured at %.1f LUFS", t.Title, m.Integrated)})
+				if err := yt.SaveLoudness(t.ID, m); err != nil {
+					publish(EventError{t, fmt.Errorf("saving loudness: %w", err)})
+				}
+			}
+		}
+	}
+	openPlayer := func() {
+		var err error
+		if player, err = newSink(mix); err != nil {
+			publish(EventError{Err: fmt.Errorf("opening audio sink, playing into the void: %w", err)})
+			player = newPacedSink(mix, nopWriteCloser{io.Discard})
+		}
+		applyVolume()
+	}
+	// start cuts to the loaded track
+	start := func(l *trackLoad, loaded CmdTrackLoaded) {
+		publish(EventInfo{fmt.Sprintf("decoder initialized for %s", l.track.Title)})
+		if player == nil {
+			openPlayer()
+		}
+		// whatever oto buffered is silence or the previous track
+		player.Reset()
+		loaded.reader.SetGain(gainFor(l.track))
+		loaded.reader.SetSpeed(speedFor(l.track))
+		mix.play(loaded.reader)
+		player.Play()
+		begin(l, loaded)
+	}
+	// prefetch gets the tracks that come after the playing one ready. The
+	// next one is opened and buffered, the ones after it only get their
+	// stream url resolved.
+	prefetch = func() {
+		var next []*Track
+		if prefetchTracks > 0 {
+			next = queue.peek(prefetchTracks, fromQueue)
+		}
+		if prefetched != nil && (len(next) == 0 || prefetched.track != next[0]) {
+			mix.setNext(nil)
+			prefetched.discard()
+			prefetched = nil
+		}
+		if len(next) == 0 || reader == nil {
+			return
+		}
+		if prefetched == nil {
+			t := next[0]
+			ctx, cancel := context.WithCancel(context.Background())
+			prefetched = &trackLoad{track: t, ctx: ctx, cancel: cancel}
+			go loadTrack(ctx, t, t.streamURL(), prefetchBuffer)
+		}
+		switch l := prefetched.loaded; {
+		case sleepTracks == 1: // playback stops after this track
+			mix.setNext(nil)
+		case l != nil && l.err == nil:
+			mix.setNext(l.reader) // play cleared it, or it just finished loading
+		}
+		for _, t := range next[1:] {
+			if !t.Local() && t.streamURL() == "" && !resolving[t] {
+				resolving[t] = true
+				go resolveStreamURL(context.Background(), t)
+			}
+		}
+	}
+	play := func(t *Track, inQueue bool) {
+		fromQueue = inQueue
+		cancelLoad()
+		stop()
+		if l := prefetched; l != nil && l.track == t {
+			prefetched = nil
+			switch {
+			case l.loaded == nil: // still loading, carry on with it
+				loading = l
+				publish(EventLoading(*t))
+				return
+			case l.loaded.err == nil:
+				start(l, *l.loaded)
+				return
+			}
+			l.cancel()
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		loading = &trackLoad{track: t, ctx: ctx, cancel: cancel}
+		publish(EventLoading(*t))
+		go loadTrack(ctx, t, t.streamURL(), 0)
+	}
+	duration := func() time.Duration {
+		switch {
+		case reader != nil && reader.Duration() > 0:
+			return reader.Duration()
+		case trackPlaying != nil:
+			return time.Second * time.Duration(trackPlaying.DurationSeconds)
+		}
+		return 0
+	}
+	// what has actually been heard, the decoder is ahead by whatever oto
+	// and the prefetch buffer hold. oto holds audio that is already sped up.
+	elapsed := func() time.Duration {
+		played := float64(player.BufferedSize())*reader.Speed() + float64(reader.Buffered())
+		return max(reader.Progress()-time.Duration(played)*time.Second/bytesPerSecond, 0)
+	}
+	progress := func() {
+		if reader != nil {
+			publish(EventProgress{elapsed(), duration()})
+		}
+	}
+	// sleepLeft is how long until the sleep timer stops playback, ok is
+	// false if that isn't known. Stopping after tracks is only known during
+	// the last one.
+	sleepLeft := func() (left time.Duration, ok bool) {
+		switch {
+		case !sleepAt.IsZero():
+			return time.Until(sleepAt), true
+		case sleepTracks == 1 && reader != nil && duration() > 0:
+			return time.Duration(float64(duration()-elapsed()) / reader.Speed()), true
+		}
+		return 0, false
+	}
+	sleepChanged := func() {
+		left, _ := sleepLeft()
+		publish(EventSleepChanged{!sleepAt.IsZero() || sleepTracks > 0, max(left, 0), sleepTracks})
+	}
+	// fadeForSleep lowers the volume over the last sleepFade before sleeping
+	fadeForSleep := func() {
+		gain := 1.0
+		if left, ok := sleepLeft(); ok && left < sleepFade {
+			gain = max(left, 0).Seconds() / sleepFade.Seconds()
+		}
+		if gain != sleepGain {
+			sleepGain = gain
+			applyVolume()
+		}
+	}
+	setSleep := func(at time.Time, tracks int) {
+		sleepAt, sleepTracks = at, max(tracks, 0)
+		fadeForSleep()
+		sleepChanged()
+		prefetch() // the mixer mustn't go on by itself after the last track
+	}
+	pause := func() {
+		if state == StatePlaying {
+			player.Pause()
+			setState(StatePaused)
+		}
+	}
+	resume := func() {
+		if state == StatePaused {
+			player.Play()
+			setState(StatePlaying)
+		}
+	}
 
 	for cmd := range cmdCh {
 		switch cmd := cmd.(type) {
 		case CmdStop:
+			cancelLoad()
 			if cleanup != nil {
-				cleanup()
-				cleanup = nil
-				events <- fmt.Sprintln("[INFO] asked to stop")
+				stop()
+				publish(EventInfo{"asked to stop"})
+			}
+		case CmdCancelLoad:
+			cancelLoad()
+		case CmdPause:
+			pause()
+		case CmdResume:
+			resume()
+		case CmdTogglePause:
+			if state == StatePaused {
+				resume()
+			} else {
+				pause()
+			}
+		case CmdSetVolume:
+			setVolume(cmd.Volume, muted)
+		case CmdChangeVolume:
+			// changing the volume unmutes, like most players do
+			setVolume(volume+cmd.Delta, false)
+		case CmdSetMuted:
+			setVolume(volume, cmd.Muted)
+		case CmdToggleMute:
+			setVolume(volume, !muted)
+		case CmdSeek:
+			if reader == nil {
+				continue
+			}
+			pos := cmd.Offset
+			if !cmd.Absolute {
+				pos += elapsed()
+			}
+			if d := duration(); d > 0 {
+				pos = min(pos, d)
+			}
+			pos = max(0, pos)
+			reader.Seek(pos)
+			// drop what oto already buffered from the old position
+			player.Reset()
+			if state == StatePlaying {
+				player.Play()
+			}
+			publish(EventInfo{fmt.Sprintf("seeking to %s", pos)})
+			progress()
+		case CmdProgressTick:
+			if state == StatePlaying {
+				progress()
 			}
+			if !sleepAt.IsZero() && !time.Now().Before(sleepAt) {
+				cancelLoad()
+				pause()
+				publish(EventInfo{"sleep timer went off"})
+				setSleep(time.Time{}, 0)
+			} else if !sleepAt.IsZero() || sleepTracks > 0 {
+				fadeForSleep()
+				sleepChanged()
+			}
+		case CmdSetShuffle:
+			queue.setShuffle(cmd.Shuffle)
+			publish(EventShuffleChanged{queue.shuffle})
+			queueChanged()
+		case CmdToggleShuffle:
+			queue.setShuffle(!queue.shuffle)
+			publish(EventShuffleChanged{queue.shuffle})
+			queueChanged()
+		case CmdSetShuffleSeed:
+			queue.setSeed(cmd.Seed)
+		case CmdSetRepeat:
+			queue.repeat = cmd.Repeat
+			publish(EventRepeatChanged{queue.repeat})
+			prefetch()
+		case CmdCycleRepeat:
+			queue.repeat = queue.repeat.Next()
+			publish(EventRepeatChanged{queue.repeat})
+			prefetch()
 		case CmdSetQueue:
-			queue = cmd.Tracks
-			queueIndex = 0
+			queue.set(slices.Clone(cmd.Tracks))
+			queueChanged()
+		case CmdAddToQueue:
+			queue.add(cmd.Tracks...)
+			queueChanged()
+		case CmdQueueNext:
+			queue.insertNext(cmd.Tracks...)
+			queueChanged()
+		case CmdRemoveFromQueue:
+			queue.remove(cmd.Index)
+			queueChanged()
+		case CmdMoveInQueue:
+			queue.move(cmd.From, cmd.To)
+			queueChanged()
+		case CmdClearQueue:
+			queue.clear()
+			queueChanged()
 		case CmdStartQueue:
-			if len(queue) >= 1 {
-				trackPlaying = queue[queueIndex]
-			} else {
-				events <- fmt.Errorf("Queue too small to play %d", len(queue))
-				return
+			t := queue.current()
+			if t == nil {
+				t, _ = queue.next()
 			}
-			events <- fmt.Sprintf("[INFO] playing track %d: %s from queue", queueIndex, trackPlaying.Title)
-			// TODO: Take cancelable context and pass it
-			go PlayTrack(trackPlaying)
-			queueIndex++
-			queueIndex %= len(queue)
-		case CmdSetQueuePosition:
-			i := slices.Index(queue, cmd.Track)
-			if i != -1 {
-				queueIndex = i
+			if t == nil {
+				publish(EventError{Err: fmt.Errorf("queue too small to play %d", len(queue.tracks))})
+				continue
+			}
+			publish(EventInfo{fmt.Sprintf("playing track %d: %s from queue", queue.index(), t.Title)})
+			play(t, true)
+			queueChanged()
+		case CmdPlayNextTrack:
+			if t, ok := queue.next(); ok {
+				play(t, true)
+				queueChanged()
 			}
-		case CmdFetchStreamURL:
-			var t *Track = cmd.Track
-			events <- fmt.Sprintf("[INFO] Trying to fetch stream url for %v\n", *t)
-			if t.StreamingURL != "" {
+		case CmdPlayPreviousTrack:
+			if queue.empty() {
 				continue
 			}
-			url, err := yt.GetStreamURL(t.VideoURL)
-			if err != nil {
-				events <- err
+			play(queue.previous(), true)
+			queueChanged()
+		case CmdTrackEnded:
+			if cmd.reader != reader { // a track that faded out, or was stopped
+				if c, ok := retired[cmd.reader]; ok {
+					c()
+					delete(retired, cmd.reader)
+				}
 				continue
 			}
-			events <- fmt.Sprintf("[INFO] Fetched streaming URL %s\n", url)
-			t.StreamingURL = url
-		case CmdPlayTrack:
-			var t *Track = cmd.Track
-			if t.StreamingURL == "" {
-				events <- fmt.Errorf("Trying to play but streaming url is empty for %v\n", t)
+			publish(EventTrackEnded(*trackPlaying))
+			if cmd.fading {
+				retired[reader] = cleanup
+			} else {
+				cleanup()
+			}
+			cleanup, reader = nil, nil
+			// a track played on its own (PlayTrack) doesn't repeat,
+			// the queue just carries on after it
+			var next *Track
+			var ok bool
+			if fromQueue {
+				next, ok = queue.afterEnd()
+			} else {
+				next, ok = queue.next()
+			}
+			if sleepTracks > 0 {
+				sleepTracks--
+				if sleepTracks == 0 {
+					// the queue already moved on, so it carries on with
+					// the next track when started again
+					if cmd.next != nil {
+						mix.clear()
+					}
+					setState(StateStopped)
+					publish(EventInfo{"stopped for the sleep timer"})
+					setSleep(time.Time{}, 0)
+					continue
+				}
+				sleepChanged()
+			}
+			if l := prefetched; cmd.next != nil && ok && l != nil && l.track == next &&
+				l.loaded != nil && l.loaded.reader == cmd.next {
+				// the mixer went on with the prefetched track by itself
+				prefetched = nil
+				fromQueue = true
+				begin(l, *l.loaded)
+				queueChanged()
 				continue
 			}
-			events <- fmt.Sprintf("[INFO] Getting response body for track %s\n", t.Title)
-			resp, err := http.Get(t.StreamingURL)
-			if err != nil {
-				events <- err
+			if cmd.next != nil { // the queue changed before we heard from the mixer
+				mix.clear()
+			}
+			setState(StateStopped)
+			if ok {
+				play(next, true)
+				queueChanged()
+			}
+		case CmdSetCrossfade:
+			wasOff := crossfade > 0 && prefetchTracks == 0
+			crossfade = max(cmd.Duration, 0)
+			mix.setCrossfade(crossfade)
+			if !wasOff && crossfade > 0 && prefetchTracks == 0 {
+				publish(EventError{Err: errCrossfadeNeedsPrefetch})
+			}
+		case CmdSetEqualizer:
+			eqEnabled = cmd.Enabled
+			applyEqualizer()
+		case CmdToggleEqualizer:
+			eqEnabled = !eqEnabled
+			applyEqualizer()
+		case CmdSetEqualizerPreset:
+			p, ok := FindEQPreset(cmd.Preset)
+			if !ok {
+				publish(EventError{Err: fmt.Errorf("unknown equalizer preset %q", cmd.Preset)})
 				continue
 			}
-			f := httprs.NewHttpReadSeeker(resp)
-			reader, _, err := newWebMReader(f)
-			events <- fmt.Sprintf("[INFO] Decoder initialized for %s\n", t.Title)
-			if err != nil {
-				events <- err
+			eqPreset = p
+			applyEqualizer()
+		case CmdSetSpeed:
+			setSpeed(cmd.Speed)
+		case CmdChangeSpeed:
+			setSpeed(speed + cmd.Delta)
+		case CmdSetDefaultSpeeds:
+			defaultSpeed, playlistSpeeds = max(MinSpeed, min(cmd.Default, MaxSpeed)), cmd.Playlists
+			if trackPlaying == nil {
+				setSpeed(defaultSpeed)
+			}
+		case CmdSleepTimer:
+			if cmd.Duration > 0 {
+				setSleep(time.Now().Add(cmd.Duration), 0)
+			} else {
+				setSleep(time.Time{}, 0)
+			}
+		case CmdStopAfter:
+			setSleep(time.Time{}, cmd.Tracks)
+		case CmdSetNormalization:
+			normalization, targetLoudness = cmd.Mode, cmd.Target
+			if reader != nil {
+				reader.SetGain(gainFor(trackPlaying))
+			}
+			if l := prefetched; l != nil && l.loaded != nil && l.loaded.err == nil {
+				l.loaded.reader.SetGain(gainFor(l.track))
+			}
+		case CmdSetSink:
+			newSink = cmd.Open
+			if player == nil {
+				continue // opened once something plays
+			}
+			if err := player.Close(); err != nil {
+				publish(EventError{Err: fmt.Errorf("closing audio sink: %w", err)})
+			}
+			openPlayer()
+			if state == StatePlaying {
+				player.Play()
+			}
+		case CmdPlayFromQueue:
+			if cmd.Index < 0 || cmd.Index >= len(queue.tracks) {
 				continue
 			}
-			player = otoCtx.NewPlayer(reader)
-			player.Play()
-			events <- fmt.Sprintf("[INFO] player is playing %s\n", t.Title)
-			events <- EventTrackStarted(*t)
-			trackPlaying = t
-			if cleanup != nil {
-				panic("assert: cleanup should be nil before playing track")
+			queue.setIndex(cmd.Index)
+			play(queue.current(), true)
+			queueChanged()
+		case CmdSetQueuePosition:
+			i := slices.Index(queue.tracks, cmd.Track)
+			if i != -1 {
+				queue.setIndex(i)
+				queueChanged()
+			}
+		case CmdPlayTrack:
+			play(cmd.Track, false)
+		case CmdTrackLoaded:
+			switch {
+			case loading != nil && loading.ctx == cmd.ctx:
+				l := loading
+				loading = nil
+				if cmd.err != nil {
+					l.cancel()
+					publish(EventLoadFailed{*l.track, cmd.err})
+					continue
+				}
+				start(l, cmd)
+				prefetch()
+			case prefetched != nil && prefetched.ctx == cmd.ctx:
+				if cmd.err != nil {
+					// play loads it again the normal way
+					publish(EventError{prefetched.track, fmt.Errorf("prefetching: %w", cmd.err)})
+				} else {
+					cmd.reader.SetGain(gainFor(prefetched.track))
+					cmd.reader.SetSpeed(speedFor(prefetched.track))
+				}
+				prefetched.loaded = &cmd
+				prefetch()
+			default: // canceled or replaced
+				if cmd.reader != nil {
+					cmd.reader.Close()
+				}
+			}
+		case CmdStreamURLResolved:
+			delete(resolving, cmd.track)
+			if cmd.err != nil {
+				publish(EventError{cmd.track, fmt.Errorf("prefetching: %w", cmd.err)})
+				continue
+			}
+			if cmd.track.StreamingURL != "" {
+				publish(EventInfo{fmt.Sprintf("stream url of %s resolved again", cmd.track.Title)})
 			}
-			cleanup = func() {
-				player.Close()
-				f.Close()
-				reader.Close()
+			cmd.track.StreamingURL = cmd.url
+		case CmdSetPrefetch:
+			wasOff := crossfade > 0 && prefetchTracks == 0
+			prefetchTracks = max(cmd.Tracks, 0)
+			prefetch()
+			if !wasOff && crossfade > 0 && prefetchTracks == 0 {
+				publish(EventError{Err: errCrossfadeNeedsPrefetch})
 			}
 		case CmdRegisterPlaylists:
 			added := make(chan Playlist, 100)
@@ -143,13 +744,9 @@ func playerManager(cmdCh <-chan Command, events chan<- Event) {
 
 					list, err := yt.GetPlaylist(id)
 					if err != nil {
-						err = fmt.Errorf("fetching playlist %s: %w", id, err)
-						if err != nil {
-							events <- err
-						}
+						publish(EventError{Err: fmt.Errorf("fetching playlist %s: %w", id, err)})
 						return
 					}
-					events <- err
 					pl := Playlist{List: list}
 					for _, t := range list.Entries {
 						pl.Tracks = append(pl.Tracks, &Track{Entry: t})
@@ -162,44 +759,266 @@ func playerManager(cmdCh <-chan Command, events chan<- Event) {
 			for p := range added {
 				playlists = append(playlists, p)
 			}
+			publish(EventPlaylistsChanged{slices.Clone(playlists)})
+		case CmdRegisterFolders:
+			if len(cmd.paths) > 0 {
+				go scanFolders(cmd.paths)
+			}
+		case CmdFolderScanned:
+			if cmd.err != nil {
+				publish(EventError{Err: fmt.Errorf("scanning folder %s: %w", cmd.dir, cmd.err)})
+				break
+			}
+			if len(cmd.skipped) > 0 {
+				publish(EventInfo{skippedMessage(cmd.dir, cmd.skipped)})
+			}
+			playlists = append(playlists, cmd.playlist)
+			publish(EventPlaylistsChanged{slices.Clone(playlists)})
+		case CmdRegisterStreams:
+			if len(cmd.urls) > 0 {
+				playlists = append(playlists, streamPlaylist(cmd.urls))
+				publish(EventPlaylistsChanged{slices.Clone(playlists)})
+			}
 		case CmdGetQueue:
-			cmd.queue <- queue
+			cmd.queue <- slices.Clone(queue.tracks)
 		case CmdGetRegisteredPlaylists:
-			cmd.playlists <- playlists
+			cmd.playlists <- slices.Clone(playlists)
 		case CmdGetCurrentTrackDuration:
-			cmd.duration <- time.Second *
-				time.Duration(trackPlaying.DurationSeconds)
+			cmd.duration <- duration()
 		}
 	}
 }
 func RegisterPlaylists(playlistIDs ...string) {
 	cmdCh <- CmdRegisterPlaylists{playlistIDs}
 }
+
+// RegisterFolders scans music folders into playlists, they are played
+// like the youtube ones. Scanning happens in the background, every folder
+// is announced with EventPlaylistsChanged once it is done.
+func RegisterFolders(paths ...string) {
+	cmdCh <- CmdRegisterFolders{paths}
+}
+
+// RegisterStreams makes a playlist of urls of ogg or webm audio, icecast
+// streams or plain downloads, they are played as they are
+func RegisterStreams(urls ...string) {
+	cmdCh <- CmdRegisterStreams{urls}
+}
+
 func GetRegisteredPlaylists() []Playlist {
 	playlistsCh := make(chan []Playlist)
 	cmdCh <- CmdGetRegisteredPlaylists{playlistsCh}
 	return <-playlistsCh
 }
 
-// TODO: make this take a ctx that is cancelable
-// or an "ok" channel. The goal is to show a loading screen while
-// we prepare the player, and show a cancel button to the user
+// PlayTrack stops what is playing and starts loading t in the background.
+// EventLoading is sent right away, followed by EventTrackStarted,
+// EventLoadFailed or EventLoadCanceled
 func PlayTrack(t *Track) {
-	cmdCh <- CmdStop{}
-	cmdCh <- CmdFetchStreamURL{t}
-	// play the track
 	cmdCh <- CmdPlayTrack{t}
 }
 
-// TODO: make this take a ctx that is cancelable
-// or an "ok" channel. The goal is to show a loading screen while
-// we prepare the player, and show a cancel button to the user
+// CancelLoad aborts loading the track passed to PlayTrack
+func CancelLoad() {
+	cmdCh <- CmdCancelLoad{}
+}
+
 func PlayPlaylist(p Playlist) {
 	cmdCh <- CmdStop{}
 	cmdCh <- CmdSetQueue{p.Tracks}
 	cmdCh <- CmdStartQueue{}
 }
 
+func Pause() {
+	cmdCh <- CmdPause{}
+}
+
+func Resume() {
+	cmdCh <- CmdResume{}
+}
+
+func TogglePause() {
+	cmdCh <- CmdTogglePause{}
+}
+
+// SetVolume sets the volume in percent, 0-100
+func SetVolume(volume int) {
+	cmdCh <- CmdSetVolume{volume}
+}
+
+func ChangeVolume(delta int) {
+	cmdCh <- CmdChangeVolume{delta}
+}
+
+func SetMuted(muted bool) {
+	cmdCh <- CmdSetMuted{muted}
+}
+
+func ToggleMute() {
+	cmdCh <- CmdToggleMute{}
+}
+
+func SetShuffle(shuffle bool) {
+	cmdCh <- CmdSetShuffle{shuffle}
+}
+
+func ToggleShuffle() {
+	cmdCh <- CmdToggleShuffle{}
+}
+
+// SetShuffleSeed makes shuffled orders come from seed, the same seed
+// shuffles the same queue the same way. It's picked at random otherwise.
+func SetShuffleSeed(seed uint64) {
+	cmdCh <- CmdSetShuffleSeed{seed}
+}
+
+func SetRepeat(mode RepeatMode) {
+	cmdCh <- CmdSetRepeat{mode}
+}
+
+func CycleRepeat() {
+	cmdCh <- CmdCycleRepeat{}
+}
+
+// Seek relative to the current position
+func Seek(offset time.Duration) {
+	cmdCh <- CmdSeek{Offset: offset}
+}
+
+func SeekTo(pos time.Duration) {
+	cmdCh <- CmdSeek{Offset: pos, Absolute: true}
+}
+
+// SeekPercent jumps to percent (0-100) of the current track
+func SeekPercent(percent float64) {
+	d := GetCurrentTrackDuration()
+	SeekTo(time.Duration(float64(d) * percent / 100))
+}
+
+func GetCurrentTrackDuration() time.Duration {
+	duration := make(chan time.Duration)
+	cmdCh <- CmdGetCurrentTrackDuration{duration}
+	return <-duration
+}
+
+// SetPrefetch sets how many upcoming tracks are prepared while a track
+// plays, 0 turns prefetching off
+func SetPrefetch(tracks int) {
+	cmdCh <- CmdSetPrefetch{tracks}
+}
+
+// errCrossfadeNeedsPrefetch is published when crossfade is set but can't
+// work, the next track has to be open before the current one ends
+var errCrossfadeNeedsPrefetch = errors.New("crossfade needs prefetching, tracks play one after another while it is 0")
+
+// SetCrossfade sets how long the end of a track overlaps the start of the
+// next one, 0 plays them back to back. Only tracks that were prefetched are
+// crossfaded into, with prefetching off it reports an error and does nothing.
+func SetCrossfade(d time.Duration) {
+	cmdCh <- CmdSetCrossfade{d}
+}
+
+// SetEqualizer turns the equalizer on or off, it applies right away
+func SetEqualizer(enabled bool) {
+	cmdCh <- CmdSetEqualizer{enabled}
+}
+
+func ToggleEqualizer() {
+	cmdCh <- CmdToggleEqualizer{}
+}
+
+// SetEqualizerPreset picks one of EQPresets by name
+func SetEqualizerPreset(name string) {
+	cmdCh <- CmdSetEqualizerPreset{name}
+}
+
+// SetSpeed changes the playback speed of what plays now, without changing
+// the pitch. It is clamped to MinSpeed-MaxSpeed.
+func SetSpeed(speed float64) {
+	cmdCh <- CmdSetSpeed{speed}
+}
+
+func ChangeSpeed(delta float64) {
+	cmdCh <- CmdChangeSpeed{delta}
+}
+
+// SetDefaultSpeeds sets the speed tracks start at when the previous track
+// was from another playlist, playlists holds the ones that differ from def
+func SetDefaultSpeeds(def float64, playlists map[string]float64) {
+	cmdCh <- CmdSetDefaultSpeeds{def, maps.Clone(playlists)}
+}
+
+// SleepTimer pauses playback once d has passed, the volume fades out over
+// the last 30 seconds. 0 turns the sleep timer off. It replaces StopAfter.
+func SleepTimer(d time.Duration) {
+	cmdCh <- CmdSleepTimer{d}
+}
+
+// StopAfter stops playback once tracks more tracks ended, 1 stops after
+// the one playing now. The last one fades out like with SleepTimer.
+// 0 turns it off. It replaces SleepTimer.
+func StopAfter(tracks int) {
+	cmdCh <- CmdStopAfter{tracks}
+}
+
+// CancelSleep turns SleepTimer and StopAfter off
+func CancelSleep() {
+	cmdCh <- CmdSleepTimer{0}
+}
+
+// SetNormalization evens out the loudness of tracks, bringing them to
+// target LUFS. Tracks are measured the first time they play through.
+func SetNormalization(mode NormalizationMode, target float64) {
+	cmdCh <- CmdSetNormalization{mode, target}
+}
+
+// SetSink changes where audio goes, see ParseSink
+func SetSink(open SinkOpener) {
+	cmdCh <- CmdSetSink{open}
+}
+
+func PlayNextTrack() {
+	cmdCh <- CmdPlayNextTrack{}
+}
+
+func PlayPreviousTrack() {
+	cmdCh <- CmdPlayPreviousTrack{}
+}
+
+// progressTicker makes the player manager send EventProgress periodically
+func progressTicker() {
+	for range time.Tick(progressInterval) {
+		cmdCh <- CmdProgressTick{}
+	}
+}
+
+func AddToQueue(tracks ...*Track) {
+	cmdCh <- CmdAddToQueue{tracks}
+}
+
+// QueueNext inserts tracks right after the current one
+func QueueNext(tracks ...*Track) {
+	cmdCh <- CmdQueueNext{tracks}
+}
+
+// PlayFromQueue jumps to the track at index in the queue
+func PlayFromQueue(index int) {
+	cmdCh <- CmdPlayFromQueue{index}
+}
+
+func RemoveFromQueue(index int) {
+	cmdCh <- CmdRemoveFromQueue{index}
+}
+
+func MoveInQueue(from, to int) {
+	cmdCh <- CmdMoveInQueue{from, to}
+}
+
+func ClearQueue() {
+	cmdCh <- CmdClearQueue{}
+}
+
+// GetQueue returns a copy of the queue
 func GetQueue() []*Track {
 	queue := make(chan []*Track)
 	cmdCh <- CmdGetQueue{queue}
@@ -0,0 +1,244 @@
+package daemon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+	"ytt/YoutubeDaemon/yt"
+)
+
+// ebmlElement is an ebml element with an 8 byte size, which every parser
+// has to take
+func ebmlElement(id uint32, data ...[]byte) []byte {
+	var b []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if x := byte(id >> shift); x != 0 || len(b) > 0 {
+			b = append(b, x)
+		}
+	}
+	body := bytes.Join(data, nil)
+	b = binary.BigEndian.AppendUint64(b, uint64(len(body))|0x01<<56)
+	return append(b, body...)
+}
+
+func ebmlUint(id uint32, v uint64) []byte {
+	return ebmlElement(id, binary.BigEndian.AppendUint64(nil, v))
+}
+
+func ebmlFloat(id uint32, v float64) []byte {
+	return ebmlElement(id, binary.BigEndian.AppendUint64(nil, math.Float64bits(v)))
+}
+
+// testWebMFile is a webm file with one opus track of the given length, in
+// clusters of a second. Its packets are 20ms celt frames without data,
+// which decode as silence.
+func testWebMFile(d time.Duration) []byte {
+	header := ebmlElement(0x1a45dfa3,
+		ebmlElement(0x4282, []byte("webm")),
+		ebmlUint(0x4287, 2),
+		ebmlUint(0x4285, 2),
+	)
+	segment := [][]byte{
+		ebmlElement(0x114d9b74), // empty seek head, so there are no cues
+		ebmlElement(0x1549a966,
+			ebmlUint(0x2ad7b1, 1000000),
+			ebmlFloat(0x4489, float64(d.Milliseconds())),
+		),
+		ebmlElement(0x1654ae6b, ebmlElement(0xae,
+			ebmlUint(0xd7, 1),
+			ebmlUint(0x73c5, 1),
+			ebmlUint(0x83, 2),
+			ebmlElement(0x86, []byte("A_OPUS")),
+			ebmlElement(0xe1,
+				ebmlFloat(0xb5, 48000),
+				ebmlUint(0x9f, 2),
+			),
+		)),
+	}
+	for second := time.Duration(0); second < d; second += time.Second {
+		cluster := [][]byte{ebmlUint(0xe7, uint64(second.Milliseconds()))}
+		for at := time.Duration(0); at < time.Second && second+at < d; at += 20 * time.Millisecond {
+			block := []byte{0x81, 0, 0, 0x80, 0xfc} // track 1, keyframe, celt fullband 20ms stereo
+			binary.BigEndian.PutUint16(block[1:], uint16(at.Milliseconds()))
+			cluster = append(cluster, ebmlElement(0xa3, block))
+		}
+		segment = append(segment, ebmlElement(0x1f43b675, cluster...))
+	}
+	return append(header, ebmlElement(0x18538067, segment...)...)
+}
+
+// settledGoroutines waits for goroutines that are on their way out. Keep-alive
+// connections of the client have goroutines of their own, they are closed
+// once they are idle.
+func settledGoroutines(want int) int {
+	idle := http.DefaultTransport.(*http.Transport).CloseIdleConnections
+	idle()
+	n := runtime.NumGoroutine()
+	for i := 0; i < 100 && n > want; i++ {
+		time.Sleep(10 * time.Millisecond)
+		idle()
+		n = runtime.NumGoroutine()
+	}
+	return n
+}
+
+// startDaemon starts the player manager once, the audio context it opens
+// can't be made twice
+var startDaemon = sync.OnceFunc(InitDaemon)
+
+func TestPlayingTracksLeavesNoGoroutines(t *testing.T) {
+	// closing the stream stops the webm reader in the middle of a file, but
+	// not once it reached the end. The short tracks fit in its channel, so
+	// it gets there even if nothing takes their packets.
+	long, short := testWebMFile(10*time.Second), testWebMFile(60*time.Millisecond)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file := long
+		if r.URL.Path == "/short" {
+			file = short
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(file))
+	}))
+	defer ts.Close()
+
+	startDaemon()
+	sub := Subscribe(256, DropOldest)
+	defer sub.Unsubscribe()
+	play := func(i int) {
+		t.Helper()
+		track := &Track{Entry: yt.Entry{ID: fmt.Sprint(i), Title: fmt.Sprint("track ", i)}, StreamingURL: ts.URL}
+		if i%2 == 0 {
+			track.StreamingURL += "/short"
+		}
+		PlayTrack(track)
+		timeout := time.After(10 * time.Second)
+		for {
+			select {
+			case e := <-sub.C:
+				switch e := e.(type) {
+				case EventTrackStarted:
+					if e.ID != track.ID {
+						break
+					}
+					if i%2 == 0 {
+						time.Sleep(20 * time.Millisecond) // for the short track to come in
+					}
+					return
+				case EventLoadFailed:
+					t.Fatalf("playing %s: %v", e.Track.Title, e.Err)
+				}
+			case <-timeout:
+				t.Fatalf("track %d didn't start", i)
+			}
+		}
+	}
+	// the first track starts the audio player, which stays around
+	play(0)
+	before := settledGoroutines(0)
+	// every track stops the one before it
+	for i := range 100 {
+		play(i + 1)
+	}
+	if after := settledGoroutines(before); after > before {
+		buf := make([]byte, 1<<20)
+		t.Fatalf("%d goroutines while playing the first track, %d after 100 more\n%s",
+			before, after, buf[:runtime.Stack(buf, true)])
+	}
+}
+
+func TestRegisteringPublishesPlaylists(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "a.webm"), nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	startDaemon()
+	sub := Subscribe(16, DropOldest)
+	defer sub.Unsubscribe()
+	before := len(GetRegisteredPlaylists())
+
+	RegisterFolders(dir)
+	RegisterStreams("http://radio.example/live.opus")
+	var got []Playlist
+	timeout := time.After(10 * time.Second)
+	for len(got) < before+2 {
+		select {
+		case e := <-sub.C:
+			if e, ok := e.(EventPlaylistsChanged); ok {
+				got = e.Playlists
+			}
+		case <-timeout:
+			t.Fatalf("%d playlists published, want %d", len(got), before+2)
+		}
+	}
+	// the folder is scanned in the background, it can come in last
+	titles := []string{got[len(got)-2].Title, got[len(got)-1].Title}
+	want := []string{filepath.Base(dir), "Streams"}
+	slices.Sort(titles)
+	slices.Sort(want)
+	if !slices.Equal(titles, want) {
+		t.Errorf("published %q, want %q", titles, want)
+	}
+
+	// callers get their own copy of the list
+	playlists := GetRegisteredPlaylists()
+	playlists[0] = Playlist{}
+	if GetRegisteredPlaylists()[0].Title == "" {
+		t.Error("changing the returned playlists changed the registered ones")
+	}
+}
+
+func TestCrossfadeWithoutPrefetchIsReported(t *testing.T) {
+	startDaemon()
+	sub := Subscribe(16, DropOldest)
+	defer sub.Unsubscribe()
+	defer SetCrossfade(0)
+	defer SetPrefetch(1)
+
+	reported := func() bool {
+		// getting the playlists is a command too, so the ones before it were
+		// handled, and the marker comes after what they published
+		GetRegisteredPlaylists()
+		marker := EventInfo{t.Name()}
+		publish(marker)
+		found := false
+		for e := range sub.C {
+			if e == marker {
+				return found
+			}
+			if e, ok := e.(EventError); ok && errors.Is(e, errCrossfadeNeedsPrefetch) {
+				found = true
+			}
+		}
+		return found
+	}
+	SetPrefetch(1)
+	SetCrossfade(2 * time.Second)
+	if reported() {
+		t.Error("crossfade with prefetching was reported")
+	}
+	SetPrefetch(0)
+	if !reported() {
+		t.Error("turning prefetching off under crossfade wasn't reported")
+	}
+	SetCrossfade(3 * time.Second)
+	if reported() {
+		t.Error("it was reported again while it still can't crossfade")
+	}
+	SetPrefetch(1)
+	SetCrossfade(0)
+	SetPrefetch(0)
+	SetCrossfade(time.Second)
+	if !reported() {
+		t.Error("setting crossfade with prefetching off wasn't reported")
+	}
+}
@@ -0,0 +1,177 @@
+package daemon
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/ebml-go/webm"
+)
+
+// demuxer takes the opus packets out of a container. It works on a
+// goroutine of its own and hands the packets over on a channel, so the
+// decoder can stop waiting for it when the reader is closed.
+type demuxer interface {
+	packets() <-chan demuxPacket // closed once the demuxer is shut down
+	// seek moves to t. The packets queued before it still come, then a
+	// packet with seeked set confirms it.
+	seek(t time.Duration)
+	seekable() bool
+	shutdown()
+	info() streamInfo
+}
+
+type demuxPacket struct {
+	data     []byte
+	timecode time.Duration // where the audio after skip starts, -1 if it doesn't say
+	skip     int           // frames at 48kHz to decode but drop, the preroll before a seek target
+	info     *streamInfo   // set on the first packet of a new link of a chained stream
+	seeked   bool          // confirms a seek, it has no data
+	end      bool          // the stream ran out, it can still be seeked back into
+}
+
+// streamInfo is what a demuxer read from the headers of the stream
+type streamInfo struct {
+	rate, channels int           // to decode with, see decoderFormat
+	preSkip        int           // frames at 48kHz to drop from the start of the decoded audio
+	gain           float32       // linear, what the stream asks to scale the audio by
+	duration       time.Duration // 0 if unknown
+	title, artist  string        // from the tags, empty if it doesn't have them
+}
+
+// magic numbers at the start of the containers
+var (
+	oggMagic  = []byte("OggS")
+	ebmlMagic = []byte{0x1a, 0x45, 0xdf, 0xa3} // webm and matroska
+)
+
+// newDemuxer picks the demuxer for rs by its first bytes
+func newDemuxer(rs io.ReadSeeker) (demuxer, error) {
+	s := &sniffer{ReadSeeker: rs}
+	magic := make([]byte, 4)
+	n, err := io.ReadFull(rs, magic)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	s.peeked = magic[:n]
+	s.head = s.peeked
+	switch {
+	case bytes.Equal(s.peeked, oggMagic):
+		return newOggDemuxer(s)
+	case bytes.Equal(s.peeked, ebmlMagic):
+		return newWebMDemuxer(s)
+	}
+	return nil, errors.New("unknown container, only webm, matroska and ogg are supported")
+}
+
+// sniffer hands out the bytes newDemuxer read to tell the container again,
+// so the stream doesn't have to seek back for them. Over http that would
+// be another request.
+type sniffer struct {
+	io.ReadSeeker
+	peeked []byte // read from the start of the stream
+	head   []byte // the part of peeked that wasn't read again yet
+}
+
+func (s *sniffer) Read(p []byte) (int, error) {
+	if len(s.head) > 0 {
+		n := copy(p, s.head)
+		s.head = s.head[n:]
+		return n, nil
+	}
+	return s.ReadSeeker.Read(p)
+}
+
+func (s *sniffer) Seek(offset int64, whence int) (int64, error) {
+	// while head is left, the stream itself is at the end of peeked
+	n := int64(len(s.peeked))
+	switch {
+	case whence == io.SeekEnd || len(s.head) == 0:
+		s.head = nil
+		return s.ReadSeeker.Seek(offset, whence)
+	case whence == io.SeekCurrent:
+		offset += n - int64(len(s.head))
+	}
+	if offset >= 0 && offset <= n {
+		s.head = s.peeked[offset:]
+		return offset, nil
+	}
+	s.head = nil
+	return s.ReadSeeker.Seek(offset, io.SeekStart)
+}
+
+// webmDemuxer reads webm and matroska with github.com/ebml-go/webm
+type webmDemuxer struct {
+	reader *webm.Reader
+	file   webm.WebM
+	track  *webm.TrackEntry
+	ch     chan demuxPacket
+}
+
+func newWebMDemuxer(rs io.ReadSeeker) (*webmDemuxer, error) {
+	d := &webmDemuxer{ch: make(chan demuxPacket, 4)}
+	var err error
+	d.reader, err = webm.Parse(rs, &d.file)
+	if err != nil {
+		return nil, err
+	}
+	d.track = d.file.FindFirstAudioTrack()
+	switch {
+	case d.track == nil:
+		err = errors.New("no audio track found")
+	case d.track.CodecID != "A_OPUS":
+		err = fmt.Errorf("%s audio isn't supported, only opus is", d.track.CodecID)
+	}
+	if err != nil {
+		d.reader.Shutdown()
+		go drain(d.reader.Chan)
+		return nil, err
+	}
+	go d.forward()
+	return d, nil
+}
+
+// forward turns the packets of the webm reader into demuxPackets
+func (d *webmDemuxer) forward() {
+	defer close(d.ch)
+	for p := range d.reader.Chan {
+		packet := demuxPacket{data: p.Data, timecode: p.Timecode}
+		switch {
+		case len(p.Data) == 0 && p.Timecode == webm.BadTC:
+			// sent once it runs out of clusters
+			packet.end = true
+		case len(p.Data) == 0:
+			// the webm reader confirms a seek with an empty packet
+			packet.seeked = true
+		case p.TrackNumber != d.track.TrackNumber:
+			continue // video, or another audio track
+		}
+		if p.Timecode == webm.BadTC { // laced packets don't carry their own timecode
+			packet.timecode = -1
+		}
+		d.ch <- packet
+	}
+}
+
+func (d *webmDemuxer) packets() <-chan demuxPacket { return d.ch }
+func (d *webmDemuxer) seek(t time.Duration)        { d.reader.Seek(t) }
+func (d *webmDemuxer) seekable() bool              { return true }
+func (d *webmDemuxer) shutdown()                   { d.reader.Shutdown() }
+
+func (d *webmDemuxer) info() streamInfo {
+	rate, channels := decoderFormat(int(d.track.SamplingFrequency), int(d.track.Channels))
+	return streamInfo{
+		rate:     rate,
+		channels: channels,
+		gain:     1,
+		duration: d.file.Segment.GetDurationMs(),
+	}
+}
+
+// drain discards what is left on a channel until it is closed
+func drain[T any](ch <-chan T) {
+	for range ch {
+	}
+}
@@ -0,0 +1,192 @@
+package daemon
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+)
+
+type EQBandType int
+
+const (
+	EQPeak      EQBandType = iota // boosts or cuts around Freq
+	EQLowShelf                    // boosts or cuts everything below Freq
+	EQHighShelf                   // boosts or cuts everything above Freq
+)
+
+// EQBand is one filter of the equalizer
+type EQBand struct {
+	Type EQBandType
+	Freq float64 // Hz
+	Gain float64 // dB
+	Q    float64 // width, higher is narrower
+}
+
+// String is a short description, like "+6dB <120Hz"
+func (b EQBand) String() string {
+	freq := fmt.Sprintf("%gHz", b.Freq)
+	if b.Freq >= 1000 {
+		freq = fmt.Sprintf("%gkHz", b.Freq/1000)
+	}
+	switch b.Type {
+	case EQLowShelf:
+		freq = "<" + freq
+	case EQHighShelf:
+		freq = ">" + freq
+	}
+	return fmt.Sprintf("%+gdB %s", b.Gain, freq)
+}
+
+type EQPreset struct {
+	Name  string
+	Bands []EQBand
+}
+
+// Description lists the bands of the preset
+func (p EQPreset) Description() string {
+	if len(p.Bands) == 0 {
+		return "no change"
+	}
+	var bands []string
+	for _, b := range p.Bands {
+		bands = append(bands, b.String())
+	}
+	return strings.Join(bands, ", ")
+}
+
+// EQPresets are the equalizer settings to choose from, the first one is flat
+var EQPresets = []EQPreset{
+	{Name: "flat"},
+	{Name: "bass boost", Bands: []EQBand{
+		{EQLowShelf, 120, 6, 0.7},
+		{EQPeak, 250, -1, 1},
+	}},
+	{Name: "vocal", Bands: []EQBand{
+		{EQLowShelf, 150, -3, 0.7},
+		{EQPeak, 300, -2, 1},
+		{EQPeak, 2500, 4, 1},
+		{EQPeak, 5000, 2, 1.5},
+	}},
+	{Name: "headphones", Bands: []EQBand{
+		{EQLowShelf, 100, 3, 0.7},
+		{EQPeak, 3000, -2, 1.5},
+		{EQHighShelf, 10000, 2, 0.7},
+	}},
+}
+
+// FindEQPreset looks a preset up by name
+func FindEQPreset(name string) (EQPreset, bool) {
+	for _, p := range EQPresets {
+		if p.Name == name {
+			return p, true
+		}
+	}
+	return EQPreset{}, false
+}
+
+// ParseEQBandType reads the band types of the config, "peak", "lowshelf"
+// or "highshelf", an empty one is a peak
+func ParseEQBandType(s string) (EQBandType, error) {
+	switch s {
+	case "", "peak":
+		return EQPeak, nil
+	case "lowshelf":
+		return EQLowShelf, nil
+	case "highshelf":
+		return EQHighShelf, nil
+	default:
+		return 0, fmt.Errorf("unknown equalizer band type %q, want \"peak\", \"lowshelf\" or \"highshelf\"", s)
+	}
+}
+
+// CustomEQPreset is the name of the preset made of the bands in the config
+const CustomEQPreset = "custom"
+
+// AddCustomEQPreset adds bands to EQPresets as the custom preset, replacing
+// an earlier one. A Q of 0 is the one the built-in presets use. EQPresets
+// isn't guarded, so it has to run before InitDaemon and the TUI.
+func AddCustomEQPreset(bands []EQBand) error {
+	bands = slices.Clone(bands)
+	for i, b := range bands {
+		if b.Freq <= 0 || b.Freq >= outputRate/2 {
+			return fmt.Errorf("equalizer band %d: frequency %gHz is outside of 0-%gHz", i+1, b.Freq, outputRate/2.)
+		}
+		if b.Q < 0 {
+			return fmt.Errorf("equalizer band %d: Q %g is negative", i+1, b.Q)
+		}
+		if b.Q == 0 {
+			bands[i].Q = 1
+			if b.Type != EQPeak {
+				bands[i].Q = 0.7
+			}
+		}
+	}
+	p := EQPreset{Name: CustomEQPreset, Bands: bands}
+	if i := slices.IndexFunc(EQPresets, func(p EQPreset) bool { return p.Name == CustomEQPreset }); i >= 0 {
+		EQPresets[i] = p
+	} else {
+		EQPresets = append(EQPresets, p)
+	}
+	return nil
+}
+
+// equalizer runs the bands of a preset over 48kHz stereo audio
+type equalizer struct {
+	filters [][outputChannels]biquad // every band, for every channel
+	preamp  float32                  // lowers the level by the biggest boost, so it doesn't clip
+}
+
+func newEqualizer(p EQPreset) *equalizer {
+	eq := &equalizer{preamp: 1}
+	boost := 0.0
+	for _, b := range p.Bands {
+		f := bandFilter(b)
+		eq.filters = append(eq.filters, [outputChannels]biquad{f, f})
+		boost = max(boost, b.Gain)
+	}
+	eq.preamp = float32(math.Pow(10, -boost/20))
+	return eq
+}
+
+// bandFilter computes the coefficients of b, from the audio eq cookbook
+// by Robert Bristow-Johnson
+func bandFilter(b EQBand) biquad {
+	a := math.Pow(10, b.Gain/40)
+	w0 := 2 * math.Pi * b.Freq / outputRate
+	cos, alpha := math.Cos(w0), math.Sin(w0)/(2*b.Q)
+	var b0, b1, b2, a0, a1, a2 float64
+	switch b.Type {
+	case EQLowShelf:
+		sq := 2 * math.Sqrt(a) * alpha
+		b0 = a * ((a + 1) - (a-1)*cos + sq)
+		b1 = 2 * a * ((a - 1) - (a+1)*cos)
+		b2 = a * ((a + 1) - (a-1)*cos - sq)
+		a0 = (a + 1) + (a-1)*cos + sq
+		a1 = -2 * ((a - 1) + (a+1)*cos)
+		a2 = (a + 1) + (a-1)*cos - sq
+	case EQHighShelf:
+		sq := 2 * math.Sqrt(a) * alpha
+		b0 = a * ((a + 1) + (a-1)*cos + sq)
+		b1 = -2 * a * ((a - 1) + (a+1)*cos)
+		b2 = a * ((a + 1) + (a-1)*cos - sq)
+		a0 = (a + 1) - (a-1)*cos + sq
+		a1 = 2 * ((a - 1) - (a+1)*cos)
+		a2 = (a + 1) - (a-1)*cos - sq
+	default:
+		b0, b1, b2 = 1+alpha*a, -2*cos, 1-alpha*a
+		a0, a1, a2 = 1+alpha/a, -2*cos, 1-alpha/a
+	}
+	return biquad{b0: b0 / a0, b1: b1 / a0, b2: b2 / a0, a1: a1 / a0, a2: a2 / a0}
+}
+
+// process filters one frame in place
+func (eq *equalizer) process(frame *[outputChannels]float32) {
+	for c := range frame {
+		x := float64(frame[c] * eq.preamp)
+		for i := range eq.filters {
+			x = eq.filters[i][c].process(x)
+		}
+		frame[c] = float32(x)
+	}
+}
@@ -0,0 +1,58 @@
+package daemon
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestAddCustomEQPreset(t *testing.T) {
+	defer func(presets []EQPreset) { EQPresets = presets }(slices.Clone(EQPresets))
+
+	bands := []EQBand{{EQPeak, 1000, 3, 2}, {EQLowShelf, 80, -2, 0}}
+	if err := AddCustomEQPreset(bands); err != nil {
+		t.Fatal(err)
+	}
+	p, ok := FindEQPreset(CustomEQPreset)
+	if !ok {
+		t.Fatal("the custom preset wasn't added")
+	}
+	want := []EQBand{{EQPeak, 1000, 3, 2}, {EQLowShelf, 80, -2, 0.7}}
+	if !slices.Equal(p.Bands, want) {
+		t.Errorf("custom preset has %v, want %v", p.Bands, want)
+	}
+	if bands[1].Q != 0 {
+		t.Error("AddCustomEQPreset changed the bands it was given")
+	}
+
+	n := len(EQPresets)
+	if err := AddCustomEQPreset([]EQBand{{EQHighShelf, 8000, 4, 0}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(EQPresets) != n {
+		t.Errorf("adding the custom preset again made %d presets, want %d", len(EQPresets), n)
+	}
+	if p, _ := FindEQPreset(CustomEQPreset); p.Description() != "+4dB >8kHz" {
+		t.Errorf("replaced custom preset is %q", p.Description())
+	}
+
+	for _, b := range []EQBand{
+		{EQPeak, 0, 3, 1},
+		{EQPeak, 30000, 3, 1},
+		{EQPeak, 1000, 3, -1},
+	} {
+		if err := AddCustomEQPreset([]EQBand{b}); err == nil {
+			t.Errorf("band %+v was accepted", b)
+		}
+	}
+}
+
+func TestParseEQBandType(t *testing.T) {
+	for s, want := range map[string]EQBandType{"": EQPeak, "peak": EQPeak, "lowshelf": EQLowShelf, "highshelf": EQHighShelf} {
+		if got, err := ParseEQBandType(s); err != nil || got != want {
+			t.Errorf("ParseEQBandType(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	if _, err := ParseEQBandType("notch"); err == nil {
+		t.Error("notch was accepted")
+	}
+}
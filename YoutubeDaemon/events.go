@@ -0,0 +1,197 @@
+package daemon
+
+import (
+	"reflect"
+	"slices"
+	"sync"
+	"time"
+)
+
+type Event any
+
+type EventTrackStarted Track
+type EventTrackEnded Track
+type EventLoading Track // resolving the stream of a track, this can take a while
+type EventLoadCanceled Track
+type EventLoadFailed struct {
+	Track Track
+	Err   error
+}
+type EventStateChanged struct{ State PlayerState }
+type EventQueueChanged struct {
+	Tracks   []*Track // copy of the queue, in queue order
+	Index    int      // index of the current track in Tracks, -1 if there is none
+	Upcoming []int    // indices into Tracks that are still to be played, in play order
+}
+type EventShuffleChanged struct{ Shuffle bool }
+type EventRepeatChanged struct{ Repeat RepeatMode }
+type EventVolumeChanged struct {
+	Volume int // percent, 0-100
+	Muted  bool
+}
+type EventSpeedChanged struct{ Speed float64 }
+type EventSleepChanged struct { // sent when the sleep timer changes, and every progressInterval while it is on
+	On        bool
+	Remaining time.Duration // until playback stops, 0 if it isn't known yet
+	Tracks    int           // tracks that end before stopping, 0 if the timer is by time
+}
+type EventEqualizerChanged struct {
+	Enabled bool
+	Preset  string
+}
+type EventProgress struct { // sent every progressInterval while a track is playing, and after seeking
+	Elapsed  time.Duration
+	Duration time.Duration // 0 if unknown
+}
+type EventBuffering struct { // the connection of a stream dropped, it is being retried
+	Track Track
+	Err   error
+}
+type EventRecovered struct{ Track Track } // the stream is back after EventBuffering
+type EventError struct {
+	Track *Track // track the error happened with, nil if it isn't about a track
+	Err   error
+}
+type EventInfo struct{ Msg string } // something worth logging
+type EventPlaylistsChanged struct { // sent when a playlist was registered after startup, like a scanned folder
+	Playlists []Playlist
+}
+
+func (e EventError) Error() string {
+	if e.Track == nil {
+		return e.Err.Error()
+	}
+	return e.Track.Title + ": " + e.Err.Error()
+}
+
+func (e EventError) Unwrap() error {
+	return e.Err
+}
+
+// coalesces reports whether e describes the whole state of something, so
+// only the latest one waiting for a subscriber matters
+func coalesces(e Event) bool {
+	switch e.(type) {
+	case EventProgress, EventStateChanged, EventQueueChanged,
+		EventShuffleChanged, EventRepeatChanged, EventVolumeChanged, EventEqualizerChanged,
+		EventSpeedChanged, EventSleepChanged, EventPlaylistsChanged:
+		return true
+	}
+	return false
+}
+
+// Policy decides what a subscription does with events its subscriber
+// isn't keeping up with
+type Policy int
+
+const (
+	// DropOldest drops the oldest waiting event when the buffer is full
+	DropOldest Policy = iota
+	// DropNewest drops incoming events while the buffer is full
+	DropNewest
+	// Coalesce replaces a waiting state event (progress, queue, volume...)
+	// with a newer one of the same type, otherwise it works like DropOldest
+	Coalesce
+)
+
+// Subscription receives the daemon's events on C, in the order they happened.
+// Publishing never waits for a subscriber, each one has its own buffer.
+type Subscription struct {
+	C <-chan Event
+
+	c       chan Event
+	size    int
+	policy  Policy
+	mu      sync.Mutex
+	pending []Event
+	wake    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+var bus struct {
+	mu   sync.Mutex
+	subs []*Subscription
+}
+
+// Subscribe starts receiving events, size is how many events can wait for
+// the subscriber before policy kicks in
+func Subscribe(size int, policy Policy) *Subscription {
+	c := make(chan Event)
+	s := &Subscription{
+		C:      c,
+		c:      c,
+		size:   max(size, 1),
+		policy: policy,
+		wake:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	bus.mu.Lock()
+	bus.subs = append(bus.subs, s)
+	bus.mu.Unlock()
+	go s.pump()
+	return s
+}
+
+// Unsubscribe stops the subscription and closes C
+func (s *Subscription) Unsubscribe() {
+	bus.mu.Lock()
+	bus.subs = slices.DeleteFunc(bus.subs, func(sub *Subscription) bool { return sub == s })
+	bus.mu.Unlock()
+	s.once.Do(func() { close(s.done) })
+}
+
+// publish sends e to every subscriber
+func publish(e Event) {
+	bus.mu.Lock()
+	defer bus.mu.Unlock()
+	for _, s := range bus.subs {
+		s.push(e)
+	}
+}
+
+func (s *Subscription) push(e Event) {
+	s.mu.Lock()
+	if s.policy == Coalesce && coalesces(e) {
+		t := reflect.TypeOf(e)
+		s.pending = slices.DeleteFunc(s.pending, func(p Event) bool { return reflect.TypeOf(p) == t })
+	}
+	if len(s.pending) >= s.size {
+		if s.policy == DropNewest {
+			s.mu.Unlock()
+			return
+		}
+		s.pending = slices.Delete(s.pending, 0, 1)
+	}
+	s.pending = append(s.pending, e)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default: // pump is already awake
+	}
+}
+
+// pump hands the waiting events to the subscriber one by one
+func (s *Subscription) pump() {
+	defer close(s.c)
+	for {
+		s.mu.Lock()
+		if len(s.pending) == 0 {
+			s.mu.Unlock()
+			select {
+			case <-s.wake:
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		e := s.pending[0]
+		s.pending = slices.Delete(s.pending, 0, 1)
+		s.mu.Unlock()
+		select {
+		case s.c <- e:
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,186 @@
+package daemon
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"ytt/YoutubeDaemon/yt"
+)
+
+// localExtensions are the files a folder scan picks up, the ones a Reader
+// can demux
+var localExtensions = map[string]bool{
+	".webm": true,
+	".mka":  true,
+	".opus": true,
+	".ogg":  true,
+	".oga":  true,
+}
+
+// audioExtensions are audio files people keep in music folders. The ones
+// that aren't in localExtensions are reported by the scan, so it's clear
+// why they are missing from the playlist.
+var audioExtensions = map[string]bool{
+	".opus": true,
+	".ogg":  true,
+	".oga":  true,
+	".mp3":  true,
+	".m4a":  true,
+	".aac":  true,
+	".flac": true,
+	".wav":  true,
+	".wma":  true,
+}
+
+// scanFolder makes a playlist of the audio files under dir, in path order.
+// Subfolders that can't be read are skipped. Audio files in formats the
+// player can't decode are left out and returned as skipped.
+func scanFolder(dir string) (p Playlist, skipped []string, err error) {
+	dir, err = filepath.Abs(dir)
+	if err != nil {
+		return Playlist{}, nil, err
+	}
+	p = Playlist{List: yt.List{
+		ID:      localID(dir),
+		Title:   filepath.Base(dir),
+		Channel: dir,
+	}}
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		switch {
+		case err != nil && path == dir:
+			return err
+		case err != nil:
+			return fs.SkipDir
+		case d.IsDir():
+			return nil
+		}
+		switch ext := strings.ToLower(filepath.Ext(path)); {
+		case localExtensions[ext]:
+			p.Tracks = append(p.Tracks, localTrack(dir, path))
+		case audioExtensions[ext]:
+			skipped = append(skipped, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return Playlist{}, nil, err
+	}
+	return p, skipped, nil
+}
+
+// skippedMessage tells which files under dir a scan left out, the first
+// few of them by name
+func skippedMessage(dir string, skipped []string) string {
+	names := make([]string, 0, 3)
+	for _, path := range skipped[:min(len(skipped), cap(names))] {
+		names = append(names, filepath.Base(path))
+	}
+	list := strings.Join(names, ", ")
+	if more := len(skipped) - len(names); more > 0 {
+		list += fmt.Sprintf(" and %d more", more)
+	}
+	return fmt.Sprintf("skipped %d files in %s that aren't in a supported format: %s", len(skipped), dir, list)
+}
+
+// scanFolders scans dirs one after the other and sends every playlist back
+// to the player manager as CmdFolderScanned. Probing a big library takes a
+// while, so it doesn't happen on the player manager's goroutine.
+func scanFolders(dirs []string) {
+	for _, dir := range dirs {
+		p, skipped, err := scanFolder(dir)
+		cmdCh <- CmdFolderScanned{dir, p, skipped, err}
+	}
+}
+
+// localTrack is the track of the file at path. Without tags the file name
+// is the title and the folder it is in under root stands in for the uploader.
+func localTrack(root, path string) *Track {
+	info := probe(path)
+	t := &Track{
+		Entry: yt.Entry{
+			ID:              localID(path),
+			Title:           info.title,
+			Uploader:        info.artist,
+			DurationSeconds: int(info.duration.Seconds()),
+		},
+		Path: path,
+	}
+	if t.Title == "" {
+		t.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if t.Uploader == "" {
+		t.Uploader = filepath.Base(root)
+		if rel, err := filepath.Rel(root, filepath.Dir(path)); err == nil && rel != "." {
+			t.Uploader = rel
+		}
+	}
+	return t
+}
+
+// localID is an id for path that works as a file name, like youtube ids do
+func localID(path string) string {
+	sum := sha1.Sum([]byte(path))
+	return "local-" + hex.EncodeToString(sum[:8])
+}
+
+// probe reads the headers of a file, what it can't read is left empty
+func probe(path string) streamInfo {
+	file, err := os.Open(path)
+	if err != nil {
+		return streamInfo{}
+	}
+	f := &fileSource{File: file}
+	defer f.Close()
+	d, err := newDemuxer(f)
+	if err != nil {
+		return streamInfo{}
+	}
+	d.shutdown()
+	drain(d.packets())
+	return d.info()
+}
+
+// fileSource is a local file for a demuxer to read. The webm reader seeks
+// once more when it shuts down, which is after Reader.Close closed the
+// source, and it panics if that fails. So seeking a closed file does nothing.
+type fileSource struct {
+	mu     sync.Mutex
+	closed bool
+	*os.File
+}
+
+func (f *fileSource) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return offset, nil
+	}
+	return f.File.Seek(offset, whence)
+}
+
+func (f *fileSource) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	return f.File.Close()
+}
+
+// openFile decodes a local file
+func openFile(path string) (*Reader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	f := &fileSource{File: file}
+	r, err := newReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", filepath.Base(path), err)
+	}
+	return r, nil
+}
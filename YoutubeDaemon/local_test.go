@@ -0,0 +1,36 @@
+package daemon
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestScanFolderSkipsUnsupported(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a.webm", "b.mp3", "notes.txt", "sub/c.MKA", "sub/d.flac"} {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, skipped, err := scanFolder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tracks []string
+	for _, track := range p.Tracks {
+		tracks = append(tracks, track.Path)
+	}
+	if want := []string{filepath.Join(dir, "a.webm"), filepath.Join(dir, "sub/c.MKA")}; !slices.Equal(tracks, want) {
+		t.Errorf("tracks %q, want %q", tracks, want)
+	}
+	if want := []string{filepath.Join(dir, "b.mp3"), filepath.Join(dir, "sub/d.flac")}; !slices.Equal(skipped, want) {
+		t.Errorf("skipped %q, want %q", skipped, want)
+	}
+}
@@ -0,0 +1,174 @@
+package daemon
+
+import (
+	"math"
+	"ytt/YoutubeDaemon/yt"
+)
+
+// NormalizationMode decides how the loudness of tracks is evened out
+type NormalizationMode int
+
+const (
+	NormalizeOff NormalizationMode = iota
+	// NormalizeTrack brings every track to the target loudness
+	NormalizeTrack
+	// NormalizeAlbum brings the queue as a whole to the target loudness, so
+	// quiet tracks stay quieter than loud ones, like ReplayGain album mode
+	NormalizeAlbum
+)
+
+func (n NormalizationMode) String() string {
+	switch n {
+	case NormalizeTrack:
+		return "track"
+	case NormalizeAlbum:
+		return "album"
+	default:
+		return "off"
+	}
+}
+
+// ParseNormalizationMode is the inverse of NormalizationMode.String, unknown strings are NormalizeOff
+func ParseNormalizationMode(s string) NormalizationMode {
+	switch s {
+	case "track":
+		return NormalizeTrack
+	case "album", "playlist":
+		return NormalizeAlbum
+	default:
+		return NormalizeOff
+	}
+}
+
+// normalizationGain is the linear gain that brings audio measured as l to
+// target LUFS, lowered if needed so its peak doesn't clip
+func normalizationGain(l yt.Loudness, target float64) float64 {
+	gain := math.Pow(10, (target-l.Integrated)/20)
+	if l.Peak > 0 {
+		gain = min(gain, 1/l.Peak)
+	}
+	return gain
+}
+
+// albumLoudness combines the loudness of tracks into one, weighted by
+// their length. ok is false if none of them were measured.
+func albumLoudness(tracks []yt.Loudness) (l yt.Loudness, ok bool) {
+	var energy, length float64
+	for _, t := range tracks {
+		energy += t.Seconds * math.Pow(10, t.Integrated/10)
+		length += t.Seconds
+		l.Peak = max(l.Peak, t.Peak)
+	}
+	if length == 0 {
+		return l, false
+	}
+	l.Integrated = 10 * math.Log10(energy/length)
+	l.Seconds = length
+	return l, true
+}
+
+// biquad is a second order iir filter, a0 is normalized to 1
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+	return y
+}
+
+// loudness measurements are made of 400ms blocks that overlap by 75%, so
+// the meter sums up 100ms steps and combines 4 of them into a block
+const (
+	loudnessStep  = outputRate / 10
+	loudnessBlock = 4
+)
+
+// loudnessMeter measures the integrated loudness of 48kHz stereo audio
+// as EBU R128 (ITU-R BS.1770) defines it
+type loudnessMeter struct {
+	weighting [outputChannels][2]biquad // K-weighting of every channel
+	steps     []float64                 // mean square of every step, summed over the channels
+	sum       float64                   // of the step being measured
+	n         int                       // frames in it
+	frames    int
+	peak      float64
+}
+
+func newLoudnessMeter() *loudnessMeter {
+	m := &loudnessMeter{}
+	for c := range m.weighting {
+		// coefficients for 48kHz from BS.1770: a high shelf for the head,
+		// and a high pass
+		m.weighting[c][0] = biquad{
+			b0: 1.53512485958697, b1: -2.69169618940638, b2: 1.19839281085285,
+			a1: -1.69065929318241, a2: 0.73248077421585,
+		}
+		m.weighting[c][1] = biquad{
+			b0: 1, b1: -2, b2: 1,
+			a1: -1.99004745483398, a2: 0.99007225036621,
+		}
+	}
+	return m
+}
+
+// add measures interleaved samples in the output format
+func (m *loudnessMeter) add(samples []float32) {
+	for i := 0; i+outputChannels <= len(samples); i += outputChannels {
+		for c := range outputChannels {
+			x := float64(samples[i+c])
+			m.peak = max(m.peak, math.Abs(x))
+			y := m.weighting[c][1].process(m.weighting[c][0].process(x))
+			m.sum += y * y
+		}
+		m.n++
+		m.frames++
+		if m.n == loudnessStep {
+			m.steps = append(m.steps, m.sum/loudnessStep)
+			m.sum, m.n = 0, 0
+		}
+	}
+}
+
+// result is the gated integrated loudness, ok is false if everything was
+// too quiet to measure
+func (m *loudnessMeter) result() (l yt.Loudness, ok bool) {
+	var blocks []float64
+	for i := loudnessBlock - 1; i < len(m.steps); i++ {
+		var z float64
+		for _, s := range m.steps[i-loudnessBlock+1 : i+1] {
+			z += s
+		}
+		blocks = append(blocks, z/loudnessBlock)
+	}
+	lufs := func(z float64) float64 { return -0.691 + 10*math.Log10(z) }
+	// gate out silence, then whatever is 10 LU below the rest
+	gated := func(threshold float64) (mean float64, n int) {
+		for _, z := range blocks {
+			if lufs(z) > threshold {
+				mean += z
+				n++
+			}
+		}
+		if n > 0 {
+			mean /= float64(n)
+		}
+		return mean, n
+	}
+	mean, n := gated(-70)
+	if n == 0 {
+		return l, false
+	}
+	mean, n = gated(lufs(mean) - 10)
+	if n == 0 {
+		return l, false
+	}
+	return yt.Loudness{
+		Integrated: lufs(mean),
+		Peak:       m.peak,
+		Seconds:    float64(m.frames) / outputRate,
+	}, true
+}
@@ -0,0 +1,202 @@
+package daemon
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+	"time"
+)
+
+// size of one stereo float32 frame
+const frameSize = 8
+
+// mixer is the only source the oto player ever reads. It plays the current
+// track and moves on to the next one by itself: straight at the end of the
+// stream when crossfade is 0 (gapless), or by overlapping the end of the
+// current track with the start of the next one.
+// The player manager is told about every transition with CmdTrackEnded.
+type mixer struct {
+	mu        sync.Mutex
+	current   *Reader
+	next      *Reader // taken over once current ends, or crossfaded into
+	fading    *Reader // previous track fading out under current
+	fadeLeft  int     // frames left until fading is silent
+	fadeLen   int     // length of the fade in frames
+	crossfade time.Duration
+	eq        *equalizer // runs over the mixed audio, nil is off
+
+	raw      []byte
+	cur, old []float32
+	mixed    []float32          // cur and old mixed, before the equalizer
+	ended    chan CmdTrackEnded // forwarded to the player manager in order
+}
+
+func newMixer() *mixer {
+	m := &mixer{ended: make(chan CmdTrackEnded, 16)}
+	go func() {
+		for e := range m.ended {
+			cmdCh <- e
+		}
+	}()
+	return m
+}
+
+// play cuts to r right away, dropping anything else
+func (m *mixer) play(r *Reader) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.current, m.next, m.fading = r, nil, nil
+}
+
+// setNext queues r to play after the current track, nil unqueues
+func (m *mixer) setNext(r *Reader) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.next = r
+}
+
+// setEqualizer swaps the equalizer, nil turns it off
+func (m *mixer) setEqualizer(eq *equalizer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.eq = eq
+}
+
+func (m *mixer) setCrossfade(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.crossfade = d
+}
+
+// clear stops mixing, the mixer plays silence until play is called
+func (m *mixer) clear() {
+	m.play(nil)
+}
+
+// Read never fails, without a track it returns silence so oto keeps going
+func (m *mixer) Read(p []byte) (int, error) {
+	frames := len(p) / frameSize
+	var ended []CmdTrackEnded
+	for done := 0; done < frames; {
+		m.mu.Lock()
+		if m.shouldCrossfade() {
+			m.fadeLen = int(min(m.crossfade, remaining(m.current)).Seconds() * bytesPerSecond / frameSize)
+			m.fadeLeft = m.fadeLen
+			m.fading, m.current, m.next = m.current, m.next, nil
+			ended = append(ended, CmdTrackEnded{reader: m.fading, next: m.current, fading: true})
+		}
+		cur, fading, eq := m.current, m.fading, m.eq
+		fadePos, fadeLen, fadeLeft := m.fadeLen-m.fadeLeft, m.fadeLen, m.fadeLeft
+		m.mu.Unlock()
+
+		want := frames - done
+		if cur == nil && fading == nil {
+			clear(p[done*frameSize:])
+			break
+		}
+		// reading blocks until the decoders catch up, so it happens unlocked
+		var curN, oldN int
+		var curEnded, oldEnded bool
+		if cur != nil {
+			curN, curEnded = m.readFrames(cur, &m.cur, want)
+		}
+		if fading != nil {
+			oldN, oldEnded = m.readFrames(fading, &m.old, min(want, fadeLeft))
+		}
+		if cap(m.mixed) < want*2 {
+			m.mixed = make([]float32, want*2)
+		}
+		mixed := m.mixed[:want*2]
+		clear(mixed)
+		for i := range want {
+			in, faded := float32(1), float32(0)
+			if fading != nil {
+				// equal power, the loudness stays the same through the fade
+				x := min(float64(fadePos+i)/float64(max(fadeLen, 1)), 1)
+				in, faded = float32(math.Sin(x*math.Pi/2)), float32(math.Cos(x*math.Pi/2))
+			}
+			for c := range outputChannels {
+				if i < curN {
+					mixed[i*2+c] += m.cur[i*2+c] * in
+				}
+				if i < oldN {
+					mixed[i*2+c] += m.old[i*2+c] * faded
+				}
+			}
+		}
+		// frames that stay in p, a gapless handoff fills the rest with the
+		// next track
+		keep := want
+
+		m.mu.Lock()
+		if fading != nil && m.fading == fading {
+			m.fadeLeft -= want
+			if m.fadeLeft <= 0 || oldEnded {
+				m.fading = nil
+				ended = append(ended, CmdTrackEnded{reader: fading})
+			}
+		}
+		if curEnded && m.current == cur {
+			m.current, m.next = m.next, nil
+			ended = append(ended, CmdTrackEnded{reader: cur, next: m.current})
+			if m.current != nil {
+				keep = curN
+			}
+		}
+		m.mu.Unlock()
+
+		// the equalizer and the tap keep state, they only see the frames
+		// that are played
+		out := p[done*frameSize:]
+		for i := range keep {
+			frame := [outputChannels]float32(mixed[i*2:])
+			if eq != nil {
+				eq.process(&frame)
+			}
+			tap.write(&frame)
+			for c, v := range frame {
+				binary.LittleEndian.PutUint32(out[(i*2+c)*4:], math.Float32bits(v))
+			}
+		}
+		done += keep
+	}
+	for _, e := range ended {
+		m.ended <- e
+	}
+	return frames * frameSize, nil
+}
+
+// crossfade into next once current is close enough to its end.
+// m.mu must be held.
+func (m *mixer) shouldCrossfade() bool {
+	if m.crossfade <= 0 || m.current == nil || m.next == nil || m.fading != nil {
+		return false
+	}
+	return m.current.Duration() > 0 && remaining(m.current) <= m.crossfade
+}
+
+// readFrames reads up to n frames of r into buf. ended is true if r ran out.
+func (m *mixer) readFrames(r *Reader, buf *[]float32, n int) (read int, ended bool) {
+	if cap(m.raw) < n*frameSize {
+		m.raw = make([]byte, n*frameSize)
+	}
+	if cap(*buf) < n*2 {
+		*buf = make([]float32, n*2)
+	}
+	*buf = (*buf)[:n*2]
+	raw := m.raw[:n*frameSize]
+	got, err := io.ReadFull(r, raw)
+	read = got / frameSize
+	gain := float32(r.Gain())
+	for i := range read * 2 {
+		(*buf)[i] = math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:])) * gain
+	}
+	return read, err != nil
+}
+
+// how long r has left to play, according to its header
+func remaining(r *Reader) time.Duration {
+	pos := r.Progress() - time.Duration(r.Buffered())*time.Second/bytesPerSecond
+	return time.Duration(float64(max(r.Duration()-pos, 0)) / r.Speed())
+}
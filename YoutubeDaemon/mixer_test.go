@@ -0,0 +1,39 @@
+package daemon
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestMixerGaplessTapsPlayedFrames(t *testing.T) {
+	file := testOpusFile(100 * time.Millisecond)
+	track := func() *Reader {
+		r, err := newReader(nopReadSeekCloser{bytes.NewReader(file)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { r.Close() })
+		return r
+	}
+	// without the goroutine newMixer forwards the ends to the daemon with
+	m := &mixer{ended: make(chan CmdTrackEnded, 16)}
+	m.setEqualizer(newEqualizer(EQPresets[1]))
+	m.play(track())
+	m.setNext(track())
+
+	before := tap.written.Load()
+	p := make([]byte, 1024*frameSize) // the first track ends in the middle of a read
+	for range 20 {
+		m.Read(p)
+	}
+	// every frame of both tracks went through the tap once, then silence up
+	// to the end of the read the second one ended in
+	frames := 2 * (5*960 - 312)
+	if got, want := tap.written.Load()-before, uint64((frames+1023)/1024*1024); got != want {
+		t.Errorf("the tap got %d frames, want %d", got, want)
+	}
+	if len(m.ended) != 2 {
+		t.Errorf("%d tracks ended, want 2", len(m.ended))
+	}
+}
@@ -0,0 +1,553 @@
+package daemon
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ogg pages (RFC 3533) carrying opus (RFC 7845)
+const (
+	oggContinued = 0x01 // the page goes on with the last packet of the page before
+	oggBOS       = 0x02 // first page of a logical stream
+	oggEOS       = 0x04 // last page of a logical stream
+
+	// granule positions count 48kHz samples, whatever the input rate was
+	opusGranuleRate = 48000
+	// the decoder needs 80ms before a seek target to converge
+	oggPreroll = 3840
+	// bisecting stops once the range is this small, and reads through the rest
+	oggSeekSpan = 64 << 10
+	// a page is at most a header, 255 lacing values and 255 segments of 255 bytes
+	oggMaxPage = 27 + 255 + 255*255
+)
+
+var (
+	opusHeadMagic = []byte("OpusHead")
+	opusTagsMagic = []byte("OpusTags")
+)
+
+type oggPage struct {
+	flags   byte
+	granule int64 // -1 if no packet ends on the page
+	serial  uint32
+	lacing  []byte
+	body    []byte
+	offset  int64 // of the page in the stream
+	size    int64 // header and body
+}
+
+// oggCRC is the table of the ogg checksum, crc32 without reflection
+var oggCRC = func() (t [256]uint32) {
+	for i := range t {
+		r := uint32(i) << 24
+		for range 8 {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		t[i] = r
+	}
+	return t
+}()
+
+func oggChecksum(crc uint32, b []byte) uint32 {
+	for _, x := range b {
+		crc = crc<<8 ^ oggCRC[byte(crc>>24)^x]
+	}
+	return crc
+}
+
+// oggDemuxer reads an opus stream out of ogg. Streams of unknown size,
+// like icecast sends, can't be seeked but are followed from one link of
+// the chain to the next.
+type oggDemuxer struct {
+	rs        io.ReadSeeker
+	br        *bufio.Reader
+	offset    int64 // of the next byte br returns
+	size      int64 // -1 if the stream can't seek
+	dataStart int64 // first page after the headers
+	serial    uint32
+	head      streamInfo // of the current link
+	first     streamInfo // of the first link, the one info returns
+
+	firstSerial uint32
+
+	packetsLeft [][]byte      // packets of the last page that weren't handed out
+	packetStart int64         // granule position packetsLeft[0] starts at, -1 if unknown
+	partial     []byte        // packet that goes on in the next page
+	tagsLeft    bool          // OpusTags is the next packet
+	linkStart   time.Duration // where the current link of a chained stream starts
+	reached     time.Duration // end of the last packet handed out
+	seekTarget  int64         // granule position of the last seek target, the preroll before it is only decoded
+	newLink     bool          // a chained stream started a new link, its first packet says so
+
+	ch       chan demuxPacket
+	seekCh   chan time.Duration
+	quit     chan struct{}
+	quitOnce sync.Once
+}
+
+func newOggDemuxer(rs io.ReadSeeker) (*oggDemuxer, error) {
+	d := &oggDemuxer{
+		rs:     rs,
+		br:     bufio.NewReaderSize(rs, oggMaxPage),
+		size:   -1,
+		ch:     make(chan demuxPacket, 4),
+		seekCh: make(chan time.Duration, 4),
+		quit:   make(chan struct{}),
+	}
+	if err := d.readHeaders(); err != nil {
+		return nil, err
+	}
+	d.dataStart = d.offset
+	// streams that know their size can seek, their last page says how long they are
+	if size, err := rs.Seek(0, io.SeekEnd); err == nil {
+		d.size = size
+		d.head.duration = d.lastTime()
+		if err := d.moveTo(d.dataStart); err != nil {
+			return nil, err
+		}
+		d.packetStart = 0
+	}
+	d.first, d.firstSerial = d.head, d.serial
+	go d.run()
+	return d, nil
+}
+
+// readHeaders reads up to the first audio page. The first pages of every
+// logical stream come first, the opus one starts with OpusHead and has
+// OpusTags next.
+func (d *oggDemuxer) readHeaders() error {
+	for {
+		p, err := d.readPage()
+		if err != nil {
+			return fmt.Errorf("reading ogg headers: %w", err)
+		}
+		if p.flags&oggBOS == 0 {
+			return errors.New("no opus stream in the ogg container")
+		}
+		if bytes.HasPrefix(p.body, opusHeadMagic) {
+			if err := d.parseHead(p.body); err != nil {
+				return err
+			}
+			d.serial, d.tagsLeft = p.serial, true
+			break
+		}
+	}
+	for len(d.packetsLeft) == 0 {
+		p, err := d.readPage()
+		if err != nil {
+			return fmt.Errorf("reading ogg headers: %w", err)
+		}
+		if p.serial == d.serial {
+			d.addPage(p)
+		}
+	}
+	d.parseTags(d.packetsLeft[0])
+	d.packetsLeft, d.tagsLeft, d.packetStart = nil, false, 0
+	return nil
+}
+
+// parseHead reads OpusHead, RFC 7845 section 5.1
+func (d *oggDemuxer) parseHead(b []byte) error {
+	if len(b) < 19 || b[8]>>4 != 0 {
+		return errors.New("bad OpusHead")
+	}
+	channels, family := int(b[9]), b[18]
+	// other mappings can pack more than one stream into a packet, that
+	// needs a multistream decoder
+	if family != 0 && (len(b) < 21 || b[19] != 1) {
+		return fmt.Errorf("opus streams with %d channels aren't supported", channels)
+	}
+	d.head.rate, d.head.channels = decoderFormat(opusGranuleRate, channels)
+	d.head.preSkip = int(binary.LittleEndian.Uint16(b[10:]))
+	// Q7.8 dB
+	gain := int16(binary.LittleEndian.Uint16(b[16:]))
+	d.head.gain = float32(math.Pow(10, float64(gain)/(20*256)))
+	return nil
+}
+
+// parseTags reads the title and artist out of OpusTags, RFC 7845 section 5.2
+func (d *oggDemuxer) parseTags(b []byte) {
+	if !bytes.HasPrefix(b, opusTagsMagic) {
+		return
+	}
+	b = b[len(opusTagsMagic):]
+	next := func() ([]byte, bool) {
+		if len(b) < 4 {
+			return nil, false
+		}
+		n := binary.LittleEndian.Uint32(b)
+		if uint64(n) > uint64(len(b)-4) {
+			return nil, false
+		}
+		s := b[4 : 4+n]
+		b = b[4+n:]
+		return s, true
+	}
+	if _, ok := next(); !ok || len(b) < 4 { // vendor string
+		return
+	}
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	for range count {
+		c, ok := next()
+		if !ok {
+			return
+		}
+		key, value, _ := strings.Cut(string(c), "=")
+		switch strings.ToUpper(key) {
+		case "TITLE":
+			d.head.title = value
+		case "ARTIST":
+			d.head.artist = value
+		}
+	}
+}
+
+// peek returns the next n bytes without reading them
+func (d *oggDemuxer) peek(n int) ([]byte, error) {
+	b, err := d.br.Peek(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF // in the middle of a page
+	}
+	return b, err
+}
+
+// readPage reads the next page. Anything that isn't one is skipped, like
+// the rest of a page a live stream reconnected in the middle of. The page
+// is only read once its checksum is right, so an "OggS" in the middle of
+// something else doesn't swallow the real page after it.
+func (d *oggDemuxer) readPage() (*oggPage, error) {
+	for {
+		for matched := 0; matched < len(oggMagic); {
+			b, err := d.br.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			d.offset++
+			switch {
+			case b == oggMagic[matched]:
+				matched++
+			case b == oggMagic[0]:
+				matched = 1
+			default:
+				matched = 0
+			}
+		}
+		// the rest of the header, after the magic
+		rest, err := d.peek(23)
+		if err != nil {
+			return nil, err
+		}
+		if rest[0] != 0 { // version
+			continue
+		}
+		segments := int(rest[22])
+		lacing, err := d.peek(23 + segments)
+		if err != nil {
+			return nil, err
+		}
+		size := 0
+		for _, l := range lacing[23:] {
+			size += int(l)
+		}
+		b, err := d.peek(23 + segments + size)
+		if err != nil {
+			return nil, err
+		}
+		var header [27]byte
+		copy(header[:], oggMagic)
+		copy(header[4:], b[:23])
+		crc := binary.LittleEndian.Uint32(header[22:])
+		clear(header[22:26])
+		if oggChecksum(oggChecksum(0, header[:]), b[23:]) != crc {
+			continue // "OggS" in the middle of something else
+		}
+		p := &oggPage{
+			flags:   header[5],
+			granule: int64(binary.LittleEndian.Uint64(header[6:])),
+			serial:  binary.LittleEndian.Uint32(header[14:]),
+			lacing:  bytes.Clone(b[23 : 23+segments]),
+			body:    bytes.Clone(b[23+segments:]),
+			offset:  d.offset - int64(len(oggMagic)),
+			size:    int64(27 + segments + size),
+		}
+		d.br.Discard(len(b))
+		d.offset += int64(len(b))
+		return p, nil
+	}
+}
+
+// addPage puts the packets that end on p in packetsLeft
+func (d *oggDemuxer) addPage(p *oggPage) {
+	packet := d.partial
+	// the start of the packet is on a page that wasn't read, after seeking
+	dropping := p.flags&oggContinued != 0 && d.partial == nil
+	if p.flags&oggContinued == 0 {
+		packet = nil
+	}
+	frames, pos := 0, 0
+	for _, l := range p.lacing {
+		if !dropping {
+			packet = append(packet, p.body[pos:pos+int(l)]...)
+		}
+		pos += int(l)
+		if l == 255 { // goes on in the next segment
+			continue
+		}
+		if !dropping {
+			d.packetsLeft = append(d.packetsLeft, packet)
+			frames += opusPacketFrames(packet)
+		}
+		packet, dropping = nil, false
+	}
+	d.partial = packet
+	// the granule position is where the last packet ends, except on the last
+	// page, which can cut the last packet short
+	if p.granule != -1 && p.flags&oggEOS == 0 && !d.tagsLeft {
+		d.packetStart = p.granule - int64(frames)
+	}
+}
+
+// nextPacket returns the next audio packet. Packets that end before the
+// preroll of a seek target are left out, the ones in the preroll are skipped
+// after decoding.
+func (d *oggDemuxer) nextPacket() (demuxPacket, error) {
+	for {
+		for len(d.packetsLeft) == 0 {
+			p, err := d.readPage()
+			if err != nil {
+				return demuxPacket{}, err
+			}
+			switch {
+			case p.flags&oggBOS != 0 && bytes.HasPrefix(p.body, opusHeadMagic):
+				// a new link of a chained stream, icecast starts one for
+				// every song and every time it is connected to
+				if err := d.parseHead(p.body); err != nil {
+					return demuxPacket{}, err
+				}
+				d.serial, d.tagsLeft, d.partial, d.newLink = p.serial, true, nil, true
+				d.linkStart, d.packetStart, d.seekTarget = d.reached, 0, 0
+			case p.serial == d.serial:
+				d.addPage(p)
+			}
+		}
+		data := d.packetsLeft[0]
+		d.packetsLeft = d.packetsLeft[1:]
+		if d.tagsLeft {
+			d.parseTags(data)
+			d.tagsLeft = false
+			continue
+		}
+		packet := demuxPacket{data: data, timecode: -1}
+		if start := d.packetStart; start != -1 {
+			frames := int64(opusPacketFrames(data))
+			d.packetStart += frames
+			d.reached = d.timeOf(d.packetStart)
+			if d.packetStart <= d.seekTarget-oggPreroll {
+				continue // before the preroll of a seek target
+			}
+			packet.skip = int(min(max(d.seekTarget-start, 0), frames))
+			packet.timecode = d.timeOf(start + int64(packet.skip))
+		}
+		if len(data) == 0 {
+			continue
+		}
+		if d.newLink {
+			info := d.head
+			packet.info, d.newLink = &info, false
+		}
+		return packet, nil
+	}
+}
+
+// timeOf is the time of granule position g of the current link
+func (d *oggDemuxer) timeOf(g int64) time.Duration {
+	return d.linkStart + time.Duration(max(g-int64(d.head.preSkip), 0))*time.Second/opusGranuleRate
+}
+
+// opusPacketFrames is the length of an opus packet in 48kHz frames, from
+// its TOC byte (RFC 6716 section 3.1)
+func opusPacketFrames(p []byte) int {
+	if len(p) == 0 {
+		return 0
+	}
+	config := p[0] >> 3
+	var frame int
+	switch {
+	case config < 12: // silk, 10 20 40 60ms
+		frame = []int{480, 960, 1920, 2880}[config&3]
+	case config < 16: // hybrid, 10 20ms
+		frame = []int{480, 960}[config&1]
+	default: // celt, 2.5 5 10 20ms
+		frame = []int{120, 240, 480, 960}[config&3]
+	}
+	switch p[0] & 3 {
+	case 0:
+		return frame
+	case 1, 2:
+		return 2 * frame
+	}
+	if len(p) < 2 {
+		return 0
+	}
+	return int(p[1]&0x3f) * frame
+}
+
+// moveTo continues reading at offset, dropping whatever was half read
+func (d *oggDemuxer) moveTo(offset int64) error {
+	if _, err := d.rs.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	d.br.Reset(d.rs)
+	d.offset = offset
+	d.packetsLeft, d.partial, d.packetStart = nil, nil, -1
+	return nil
+}
+
+// nextGranulePage reads up to the next page of the opus stream that has a
+// granule position
+func (d *oggDemuxer) nextGranulePage() (*oggPage, error) {
+	for {
+		p, err := d.readPage()
+		if err != nil {
+			return nil, err
+		}
+		if p.serial == d.serial && p.granule != -1 {
+			return p, nil
+		}
+	}
+}
+
+// lastTime is where the stream ends, from the last granule position in it
+func (d *oggDemuxer) lastTime() time.Duration {
+	if err := d.moveTo(max(d.dataStart, d.size-oggSeekSpan)); err != nil {
+		return 0
+	}
+	last := int64(-1)
+	for {
+		p, err := d.nextGranulePage()
+		if err != nil {
+			break
+		}
+		last = p.granule
+	}
+	if last == -1 {
+		return 0
+	}
+	return d.timeOf(last)
+}
+
+// bisect moves to the page the packets at t (minus the preroll) are on, by
+// bisecting the granule positions of the pages
+func (d *oggDemuxer) bisect(t time.Duration) error {
+	d.seekTarget = int64(t.Seconds()*opusGranuleRate) + int64(d.head.preSkip)
+	target := d.seekTarget - oggPreroll
+	// lo is the end of a page before target, the first page with a granule
+	// position after hi is past it
+	lo, hi := d.dataStart, d.size
+	for hi-lo > oggSeekSpan {
+		mid := lo + (hi-lo)/2
+		if err := d.moveTo(mid); err != nil {
+			return err
+		}
+		p, err := d.nextGranulePage()
+		switch {
+		case err == io.EOF || err == io.ErrUnexpectedEOF || err == nil && p.granule >= target:
+			hi = mid
+		case err != nil:
+			return err
+		default:
+			lo = p.offset + p.size
+		}
+	}
+	if err := d.moveTo(lo); err != nil {
+		return err
+	}
+	for {
+		p, err := d.nextGranulePage()
+		if err != nil || p.granule >= target {
+			break
+		}
+		lo = p.offset + p.size
+	}
+	if err := d.moveTo(lo); err != nil {
+		return err
+	}
+	if lo == d.dataStart {
+		d.packetStart = 0
+	}
+	return nil
+}
+
+func (d *oggDemuxer) run() {
+	defer close(d.ch)
+	for {
+		packet, err := d.nextPacket()
+		if err != nil {
+			// read errors end the stream like the webm reader does, the
+			// source already retried what it could
+			packet = demuxPacket{timecode: -1, end: true}
+		}
+		select {
+		case d.ch <- packet:
+			if !packet.end {
+				continue
+			}
+			// it can still seek back into the stream
+			select {
+			case t := <-d.seekCh:
+				d.seekTo(t)
+			case <-d.quit:
+				return
+			}
+		case t := <-d.seekCh:
+			d.seekTo(t)
+		case <-d.quit:
+			return
+		}
+	}
+}
+
+func (d *oggDemuxer) seekTo(t time.Duration) {
+	for len(d.seekCh) > 0 { // only the last one matters
+		t = <-d.seekCh
+	}
+	if d.seekable() {
+		// seeking only knows the first link of a chained file
+		d.head, d.serial, d.linkStart, d.tagsLeft, d.newLink = d.first, d.firstSerial, 0, false, false
+		if err := d.bisect(t); err != nil {
+			publish(EventError{Err: fmt.Errorf("seeking: %w", err)})
+		}
+	}
+	select {
+	case d.ch <- demuxPacket{timecode: t, seeked: true}:
+	case <-d.quit:
+	}
+}
+
+func (d *oggDemuxer) packets() <-chan demuxPacket { return d.ch }
+func (d *oggDemuxer) seekable() bool              { return d.size >= 0 }
+func (d *oggDemuxer) info() streamInfo            { return d.first }
+
+func (d *oggDemuxer) seek(t time.Duration) {
+	select {
+	case d.seekCh <- t:
+	case <-d.quit:
+	}
+}
+
+func (d *oggDemuxer) shutdown() {
+	d.quitOnce.Do(func() { close(d.quit) })
+}
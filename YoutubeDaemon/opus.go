@@ -2,96 +2,368 @@ package daemon
 
 import (
 	"encoding/binary"
-	"errors"
 	"fmt"
 	"io"
+	"math"
+	"sync"
+	"sync/atomic"
 	"time"
 	"ytt/YoutubeDaemon/opus"
-
-	"github.com/ebml-go/webm"
+	"ytt/YoutubeDaemon/yt"
 )
 
 // Reader encapsulates the audio decoding logic and implements io.Reader.
+// It owns the stream it decodes, Close shuts both down.
 type Reader struct {
-	pr         *io.PipeReader // Pipe reader for audio data
-	webmReader *webm.Reader
-	webmFile   webm.WebM
-	Progress   time.Duration
-	quit       bool
+	src      io.Closer
+	pr       *io.PipeReader // Pipe reader for audio data
+	demux    demuxer
+	info     streamInfo
+	progress atomic.Int64 // timecode of the last decoded packet, see Progress
+	seeking  atomic.Bool  // drop packets until the demuxer confirms the seek
+
+	done      chan struct{} // closed by Close, decode only drains the demuxer from then on
+	finished  chan struct{} // closed once decode returned
+	closeOnce sync.Once
+	closeErr  error
+
+	headMu sync.Mutex
+	head   []byte // audio decoded ahead of time by fill, Read returns it first
+
+	// every stream has its own decoder, so the prefetched and crossfading
+	// ones don't mess with the state of the one that is playing
+	decoder opus.Decoder
+	out     []float32 // decoded audio converted to the output format
+	skip    int       // frames left to drop from the start, the encoder's pre-skip
+	// gain of the link of a chained stream being decoded, info has the first one
+	linkGain float32
+
+	// loudness of the stream, measured while decoding it from start to end.
+	// Seeking makes the measurement useless, meter is nil then.
+	meter    *loudnessMeter
+	loudness *yt.Loudness  // set by decode at the end of the stream
+	gain     atomic.Uint64 // float64 bits, the mixer scales the samples by it
+
+	speed   atomic.Uint64 // float64 bits, playback speed
+	stretch *wsola        // changes the speed once it isn't 1
 }
 
-var decoder opus.Decoder
+// format of the audio a Reader returns, the player and mixer expect it
+const (
+	outputRate     = 48000
+	outputChannels = 2
+)
 
-func init() {
-	dec, err := opus.NewDecoder(48000, 2)
-	if err != nil {
-		panic(fmt.Sprintln("failed to create decoder", err))
+// decoderFormat picks the sample rate and channel count to decode a stream
+// with. Opus can decode to any of its rates, the one from the header is used
+// when it is one of them. Streams with more than 2 channels need a
+// multistream decoder, which the module doesn't have, so they are downmixed
+// to stereo.
+func decoderFormat(rate, channels int) (int, int) {
+	switch rate {
+	case 8000, 12000, 16000, 24000, 48000:
+	default:
+		rate = outputRate
+	}
+	if channels == 1 {
+		return rate, 1
 	}
-	decoder = dec
+	return rate, 2
 }
 
-// newWebMReader initializes a new Reader by parsing the WebM file and starting a decoding goroutine.
-func newWebMReader(rs io.ReadSeeker) (*Reader, *webm.TrackEntry, error) {
-	var webmFile webm.WebM
-	webmReader, err := webm.Parse(rs, &webmFile)
-
+// newReader initializes a new Reader by parsing the container, webm or ogg,
+// and starting a decoding goroutine. The reader takes over rs, it is closed
+// with the reader.
+func newReader(rs io.ReadSeekCloser) (*Reader, error) {
+	demux, err := newDemuxer(rs)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
-	track := webmFile.FindFirstAudioTrack()
-	if track == nil {
-		return nil, nil, errors.New("no audio track found")
+	info := demux.info()
+	decoder, err := opus.NewDecoder(info.rate, info.channels)
+	if err != nil {
+		demux.shutdown()
+		go drain(demux.packets())
+		return nil, fmt.Errorf("failed to create decoder: %w", err)
 	}
-
 	pr, pw := io.Pipe()
 
-	decodeBuffer := make([]float32, 1000*int(track.Channels))
+	// room for the longest opus packet, 120ms
+	decodeBuffer := make([]float32, info.rate*120/1000*info.channels)
 
 	r := &Reader{
-		pr:         pr,
-		webmReader: webmReader,
-		webmFile:   webmFile,
+		src:      rs,
+		pr:       pr,
+		demux:    demux,
+		info:     info,
+		decoder:  decoder,
+		skip:     info.preSkip,
+		linkGain: info.gain,
+		done:     make(chan struct{}),
+		finished: make(chan struct{}),
+		meter:    newLoudnessMeter(),
+		stretch:  newWSOLA(),
 	}
-	go r.decode(pw, webmReader, decodeBuffer, track)
+	r.SetGain(1)
+	r.SetSpeed(1)
+	go r.decode(pw, decodeBuffer)
 
-	return r, track, nil
+	return r, nil
 }
 
-func (r *Reader) decode(pw *io.PipeWriter, webmReader *webm.Reader, decodeBuffer []float32, track *webm.TrackEntry) {
+func (r *Reader) decode(pw *io.PipeWriter, decodeBuffer []float32) {
+	defer close(r.finished)
+	defer r.decoder.Destroy() // nothing else uses the decoder
 	defer pw.Close()
+	// the demuxer only exits after handing over all its packets, so keep
+	// receiving until it closes the channel
+	defer drain(r.demux.packets())
 	for {
-		packet := <-webmReader.Chan
-		if r.quit { // reader is closed
-			break
+		var packet demuxPacket
+		ok := true
+		select {
+		case packet, ok = <-r.demux.packets():
+		case <-r.done:
+			return
+		}
+		if r.seeking.Load() {
+			// packets that were queued before the seek, and the end of stream
+			// packet if we seeked after reaching it
+			if !packet.seeked {
+				continue
+			}
+			r.seeking.Store(false)
+			r.meter = nil
+			// seeking goes back to the first link of a chained stream, the
+			// demuxer skips the audio before the target
+			if err := r.startLink(r.info, &decodeBuffer); err != nil {
+				publish(EventError{Err: err})
+				pw.CloseWithError(err)
+				<-r.done
+				return
+			}
+			r.skip = 0
+			continue
+		}
+		if packet.seeked { // a seek that was taken back by another one
+			continue
+		}
+		if packet.end || !ok {
+			if r.meter != nil {
+				if l, ok := r.meter.result(); ok {
+					r.loudness = &l
+				}
+			}
+			pw.Close() // readers get io.EOF
+			<-r.done
+			return
 		}
-		r.Progress = packet.Timecode
-		events <- fmt.Sprintln(packet.Timecode.Seconds())
-		nSamples, err := decoder.DecodeFloat32(packet.Data, decodeBuffer)
+		if packet.info != nil {
+			if err := r.startLink(*packet.info, &decodeBuffer); err != nil {
+				publish(EventError{Err: err})
+				pw.CloseWithError(err)
+				<-r.done
+				return
+			}
+		}
+		nSamples, err := r.decoder.DecodeFloat32(packet.data, decodeBuffer)
 		if nSamples == 0 { //important or audio will stop playing on seek
 			continue
 		}
 		if err != nil {
-			events <- err
+			publish(EventError{Err: err})
 			pw.CloseWithError(err)
 		}
 
 		// Convert float32 samples to bytes and write to the pipe
-		err = binary.Write(pw, binary.LittleEndian, decodeBuffer[:nSamples*int(track.Channels)])
+		out := r.convert(decodeBuffer, nSamples)
+		r.skip += packet.skip
+		if r.skip > 0 {
+			drop := min(r.skip, len(out)/outputChannels)
+			out = out[drop*outputChannels:]
+			r.skip -= drop
+		}
+		if len(out) == 0 { // the preroll of a seek, or the pre-skip
+			continue
+		}
+		if packet.timecode != -1 {
+			r.progress.Store(int64(packet.timecode))
+		}
+		if r.linkGain != 1 {
+			for i := range out {
+				out[i] *= r.linkGain
+			}
+		}
+		if r.meter != nil {
+			r.meter.add(out)
+		}
+		err = binary.Write(pw, binary.LittleEndian, out)
+		if err == io.ErrClosedPipe { // Close closed the read end
+			<-r.done
+			return
+		}
 		if err != nil {
-			events <- err
+			publish(EventError{Err: err})
 			pw.CloseWithError(err)
 		}
 	}
 }
 
+// startLink gets the decoder ready for a link of a chained stream, starting
+// with info's pre-skip. The decoder is made again if the format changed.
+func (r *Reader) startLink(info streamInfo, decodeBuffer *[]float32) error {
+	r.skip, r.linkGain = info.preSkip, info.gain
+	if r.decoder.SampleRate() == info.rate && r.decoder.Channels() == info.channels {
+		return r.decoder.Reset()
+	}
+	decoder, err := opus.NewDecoder(info.rate, info.channels)
+	if err != nil {
+		return fmt.Errorf("failed to create decoder: %w", err)
+	}
+	r.decoder.Destroy()
+	r.decoder = decoder
+	*decodeBuffer = make([]float32, info.rate*120/1000*info.channels)
+	return nil
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+// convert turns n decoded frames into the output format, duplicating mono
+// and upsampling lower rates linearly
+func (r *Reader) convert(pcm []float32, n int) []float32 {
+	channels, factor := r.decoder.Channels(), outputRate/r.decoder.SampleRate()
+	if channels == outputChannels && factor == 1 {
+		return pcm[:n*channels]
+	}
+	frames := n * factor
+	if cap(r.out) < frames*outputChannels {
+		r.out = make([]float32, frames*outputChannels)
+	}
+	out := r.out[:frames*outputChannels]
+	for i := range frames {
+		j, frac := i/factor, float32(i%factor)/float32(factor)
+		k := min(j+1, n-1) // the last frame of the packet is held
+		for c := range outputChannels {
+			src := min(c, channels-1)
+			a, b := pcm[j*channels+src], pcm[k*channels+src]
+			out[i*outputChannels+c] = a + (b-a)*frac
+		}
+	}
+	return out
+}
+
 // Read implements the io.Reader interface by reading from the pipe.
+// Audio that was stretched once keeps going through the stretcher, at
+// speed 1 it puts the audio back together unchanged.
 func (r *Reader) Read(data []byte) (int, error) {
+	speed := r.Speed()
+	if speed == 1 && r.stretch.idle() {
+		return r.readDecoded(data)
+	}
+	return r.stretch.read(data, speed, readerFunc(r.readDecoded))
+}
+
+// readDecoded reads audio at its own speed
+func (r *Reader) readDecoded(data []byte) (int, error) {
+	r.headMu.Lock()
+	if len(r.head) > 0 {
+		n := copy(data, r.head)
+		r.head = r.head[n:]
+		r.headMu.Unlock()
+		return n, nil
+	}
+	r.headMu.Unlock()
 	return r.pr.Read(data)
 }
 
+// fill decodes d of audio ahead of time, so playing can start without
+// waiting for the network. A stream shorter than d is not an error.
+func (r *Reader) fill(d time.Duration) error {
+	buf := make([]byte, int64(d)*bytesPerSecond/int64(time.Second))
+	n, err := io.ReadFull(r.pr, buf)
+	r.headMu.Lock()
+	r.head = buf[:n]
+	r.headMu.Unlock()
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil
+	}
+	return err
+}
+
+// Loudness of the whole stream, ok is false if it wasn't decoded from
+// start to end without seeking. It waits for the reader to be closed.
+func (r *Reader) Loudness() (l yt.Loudness, ok bool) {
+	<-r.finished
+	if r.loudness == nil {
+		return l, false
+	}
+	return *r.loudness, true
+}
+
+// SetGain scales the audio of the reader when it is mixed, 1 leaves it be
+func (r *Reader) SetGain(gain float64) {
+	r.gain.Store(math.Float64bits(gain))
+}
+
+func (r *Reader) Gain() float64 {
+	return math.Float64frombits(r.gain.Load())
+}
+
+// Buffered is the number of bytes decoded by fill that haven't been read yet
+func (r *Reader) Buffered() int {
+	r.headMu.Lock()
+	defer r.headMu.Unlock()
+	return len(r.head) + r.stretch.buffered(r.Speed())
+}
+
+// SetSpeed changes how fast the reader plays, without changing the pitch.
+// It is clamped to MinSpeed-MaxSpeed.
+func (r *Reader) SetSpeed(speed float64) {
+	r.speed.Store(math.Float64bits(max(MinSpeed, min(speed, MaxSpeed))))
+}
+
+func (r *Reader) Speed() float64 {
+	return math.Float64frombits(r.speed.Load())
+}
+
+// Seek moves decoding to t, streams that can't seek (live ones) keep going
 func (r *Reader) Seek(t time.Duration) {
-	r.webmReader.Seek(t)
+	if !r.demux.seekable() {
+		return
+	}
+	r.headMu.Lock()
+	r.head = nil // audio from before the seek
+	r.headMu.Unlock()
+	r.stretch.reset()
+	r.seeking.Store(true)
+	r.progress.Store(int64(t))
+	r.demux.seek(t)
+}
+
+// Progress is how far the stream has been decoded. Decoded audio can still
+// be sitting in the player's buffer, so it runs slightly ahead of what is heard.
+func (r *Reader) Progress() time.Duration {
+	return time.Duration(r.progress.Load())
+}
+
+// Duration of the stream according to its headers, 0 if it doesn't say
+func (r *Reader) Duration() time.Duration {
+	return r.info.duration
 }
-func (r *Reader) Close() {
-	r.quit = true
+
+// Close stops decoding and closes the stream. It returns once the decoder
+// is gone, calling it again returns the same error.
+func (r *Reader) Close() error {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.pr.Close()               // unblocks Read, and the decoder writing to the pipe
+		r.closeErr = r.src.Close() // unblocks the demuxer if it waits for the network
+		r.demux.shutdown()
+		<-r.finished
+	})
+	return r.closeErr
 }
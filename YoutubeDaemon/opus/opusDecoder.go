@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"math"
+	"sync"
 
 	"github.com/tetratelabs/wazero"
 	"github.com/tetratelabs/wazero/api"
@@ -23,7 +24,12 @@ var (
 	opus_strerror,
 	opus_decode,
 	opus_decode_float,
-	decoder_create api.Function
+	decoder_create,
+	decoder_destroy api.Function // nil, the module doesn't export it
+
+	// every decoder lives in the same module instance, which can only
+	// run one call at a time
+	mu sync.Mutex
 )
 
 func init() {
@@ -41,6 +47,7 @@ func init() {
 	}
 
 	decoder_create = Mod.ExportedFunction("opus_decoder_create")
+	decoder_destroy = Mod.ExportedFunction("opus_decoder_destroy")
 	malloc = Mod.ExportedFunction("malloc")
 	free = Mod.ExportedFunction("free")
 	opus_strerror = Mod.ExportedFunction("opus_strerror")
@@ -57,11 +64,21 @@ func main() {
 }
 
 type Decoder struct {
-	ptr      uintptr // pointer to OpusDecoder in WASM memory
-	channels int     // number of output channels (e.g. 1=mono, 2=stereo)
+	ptr        uintptr // pointer to OpusDecoder in WASM memory
+	channels   int     // number of output channels (e.g. 1=mono, 2=stereo)
+	sampleRate int
 }
 
+// NewDecoder creates a decoder that outputs sample_rate samples per second
+// (8000, 12000, 16000, 24000 or 48000) of interleaved channels (1 or 2).
+// Destroy it once done, its memory lives in the wasm module.
 func NewDecoder(sample_rate int, channels int) (Decoder, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	return newDecoder(sample_rate, channels)
+}
+
+func newDecoder(sample_rate int, channels int) (Decoder, error) {
 	ctx := context.Background()
 
 	offset := Malloc(4)
@@ -80,9 +97,49 @@ func NewDecoder(sample_rate int, channels int) (Decoder, error) {
 		return Decoder{}, fmt.Errorf("opus error in NewDecoder: %s", OpusStrerror(int32(errorCode)))
 	}
 
-	return Decoder{ptr: uintptr((result[0])), channels: channels}, nil
+	return Decoder{ptr: uintptr((result[0])), channels: channels, sampleRate: sample_rate}, nil
+}
+
+// Reset drops the decoder state, so that packets from before a seek
+// don't bleed into the ones after it.
+// opus_decoder_ctl is not exported by the module, so the decoder is
+// created again instead of using OPUS_RESET_STATE.
+func (d *Decoder) Reset() error {
+	mu.Lock()
+	defer mu.Unlock()
+	dec, err := newDecoder(d.sampleRate, d.channels)
+	if err != nil {
+		return err
+	}
+	d.destroy()
+	*d = dec
+	return nil
+}
+
+// Destroy frees the decoder, it can't be used afterwards
+func (d *Decoder) Destroy() {
+	mu.Lock()
+	defer mu.Unlock()
+	d.destroy()
 }
 
+func (d *Decoder) destroy() {
+	if d.ptr == 0 {
+		return
+	}
+	if decoder_destroy != nil {
+		if _, err := decoder_destroy.Call(context.Background(), uint64(d.ptr)); err != nil {
+			panic(fmt.Errorf("opus_decoder_destroy failed: %w", err))
+		}
+	} else {
+		Free(d.ptr) // opus_decoder_destroy is just a free
+	}
+	d.ptr = 0
+}
+
+func (d *Decoder) Channels() int   { return d.channels }
+func (d *Decoder) SampleRate() int { return d.sampleRate }
+
 func Malloc(bytes int) uintptr {
 	res, err := malloc.Call(context.Background(), uint64(bytes))
 	if err != nil {
@@ -138,6 +195,8 @@ func (d *Decoder) DecodeFloat32(data []byte, pcm []float32) (int, error) {
 		return 0, errors.New("opus: target buffer capacity must be multiple of channels")
 	}
 
+	mu.Lock()
+	defer mu.Unlock()
 	ctx := context.Background()
 	mem := Mod.Memory()
 
@@ -167,7 +226,10 @@ func (d *Decoder) DecodeFloat32(data []byte, pcm []float32) (int, error) {
 		return 0, fmt.Errorf("opus_decode_float call failed: %w", err)
 	}
 
-	samples := int(result[0])
+	samples := int(int32(result[0]))
+	if samples < 0 {
+		return 0, fmt.Errorf("opus error in DecodeFloat32: %s", OpusStrerror(int32(samples)))
+	}
 
 	// Read float32 samples from WASM memory
 	raw, ok := mem.Read(uint32(pcmPtr), uint32(samples*d.channels*4))
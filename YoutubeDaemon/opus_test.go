@@ -0,0 +1,173 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// oggPageBytes builds an ogg page holding packets, none of them longer
+// than 254 bytes
+func oggPageBytes(flags byte, granule int64, serial, seq uint32, packets ...[]byte) []byte {
+	b := append([]byte(nil), oggMagic...)
+	b = append(b, 0, flags)
+	b = binary.LittleEndian.AppendUint64(b, uint64(granule))
+	b = binary.LittleEndian.AppendUint32(b, serial)
+	b = binary.LittleEndian.AppendUint32(b, seq)
+	b = binary.LittleEndian.AppendUint32(b, 0) // checksum, filled in below
+	b = append(b, byte(len(packets)))
+	for _, p := range packets {
+		b = append(b, byte(len(p)))
+	}
+	for _, p := range packets {
+		b = append(b, p...)
+	}
+	binary.LittleEndian.PutUint32(b[22:], oggChecksum(0, b))
+	return b
+}
+
+// testOpusFile is an ogg opus file of the given length. Its packets are
+// 20ms celt frames without data, which decode as silence.
+func testOpusFile(d time.Duration) []byte {
+	return testOpusLink(1, 2, 312, d)
+}
+
+// testOpusLink is a logical stream of an ogg opus file, chained files are
+// links with different serials one after the other
+func testOpusLink(serial uint32, channels byte, preSkip uint16, d time.Duration) []byte {
+	head := append([]byte(nil), opusHeadMagic...)
+	head = append(head, 1, channels) // version, channels
+	head = binary.LittleEndian.AppendUint16(head, preSkip)
+	head = binary.LittleEndian.AppendUint32(head, 48000)
+	head = append(head, 0, 0, 0) // gain, mapping family
+	tags := append([]byte(nil), opusTagsMagic...)
+	tags = binary.LittleEndian.AppendUint32(tags, 0) // vendor
+	tags = binary.LittleEndian.AppendUint32(tags, 0) // comments
+
+	b := oggPageBytes(oggBOS, 0, serial, 0, head)
+	b = append(b, oggPageBytes(0, 0, serial, 1, tags)...)
+	frames := int(d / (20 * time.Millisecond))
+	granule := int64(0) // counts the pre-skip too
+	toc := byte(0xf8)   // celt fullband 20ms
+	if channels == 2 {
+		toc |= 0x04
+	}
+	for seq := uint32(2); frames > 0; seq++ {
+		var packets [][]byte
+		for ; frames > 0 && len(packets) < 50; frames-- {
+			packets = append(packets, []byte{toc})
+			granule += 960
+		}
+		var flags byte
+		if frames == 0 {
+			flags = oggEOS
+		}
+		b = append(b, oggPageBytes(flags, granule, serial, seq, packets...)...)
+	}
+	return b
+}
+
+type nopReadSeekCloser struct{ io.ReadSeeker }
+
+func (nopReadSeekCloser) Close() error { return nil }
+
+// decodedFrames reads r to the end and counts the frames it returns
+func decodedFrames(t *testing.T, r *Reader) int {
+	t.Helper()
+	defer r.Close()
+	n, err := io.Copy(io.Discard, r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int(n / (outputChannels * 4))
+}
+
+func TestReaderSeekDropsPreroll(t *testing.T) {
+	file := testOpusFile(10 * time.Second)
+	r, err := newReader(nopReadSeekCloser{bytes.NewReader(file)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := decodedFrames(t, r)
+	if want := 500*960 - 312; all != want {
+		t.Fatalf("decoded %d frames, want %d without the pre-skip", all, want)
+	}
+
+	for _, seek := range []time.Duration{0, 40 * time.Millisecond, 5 * time.Second, 5*time.Second + 30*time.Millisecond} {
+		r, err := newReader(nopReadSeekCloser{bytes.NewReader(file)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.Seek(seek)
+		want := all - int(seek.Seconds()*outputRate)
+		if got := decodedFrames(t, r); got != want {
+			t.Errorf("decoded %d frames after seeking to %v, want %d", got, seek, want)
+		}
+		// where the last packet starts
+		if got, want := r.Progress(), time.Duration(499*960-312)*time.Second/48000; got != want {
+			t.Errorf("progress is %v at the end after seeking to %v, want %v", got, seek, want)
+		}
+	}
+}
+
+func TestReaderChainedStream(t *testing.T) {
+	// the second link is mono and has a pre-skip of its own
+	file := append(testOpusFile(time.Second), testOpusLink(2, 1, 960+100, time.Second)...)
+	r, err := newReader(nopReadSeekCloser{bytes.NewReader(file)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := decodedFrames(t, r), 2*50*960-312-(960+100); got != want {
+		t.Errorf("decoded %d frames, want %d without the pre-skip of both links", got, want)
+	}
+}
+
+func TestReaderCloseLeavesNoGoroutines(t *testing.T) {
+	file := testOpusFile(10 * time.Second)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(file))
+	}))
+	defer ts.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	before := runtime.NumGoroutine()
+	buf := make([]byte, bytesPerSecond/10)
+	for i := range 100 {
+		r, _, err := openStream(ctx, &Track{}, ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// stop at different points, some while decoding is ahead of the
+		// reads and some after a seek
+		for range i % 4 {
+			if _, err := io.ReadFull(r, buf); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if i%3 == 0 {
+			r.Seek(5 * time.Second)
+		}
+		closed := make(chan error)
+		go func() { closed <- r.Close() }()
+		select {
+		case err := <-closed:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("closing reader %d hangs", i)
+		}
+	}
+	if after := settledGoroutines(before); after > before {
+		buf := make([]byte, 1<<20)
+		t.Fatalf("%d goroutines before, %d after closing 100 readers\n%s",
+			before, after, buf[:runtime.Stack(buf, true)])
+	}
+}
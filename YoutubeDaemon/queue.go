@@ -0,0 +1,365 @@
+package daemon
+
+import (
+	"math/rand/v2"
+	"slices"
+)
+
+type RepeatMode int
+
+const (
+	RepeatOff RepeatMode = iota
+	RepeatAll
+	RepeatOne
+)
+
+func (r RepeatMode) String() string {
+	switch r {
+	case RepeatAll:
+		return "all"
+	case RepeatOne:
+		return "one"
+	default:
+		return "off"
+	}
+}
+
+// Next mode when cycling through them, off -> all -> one -> off
+func (r RepeatMode) Next() RepeatMode {
+	return (r + 1) % 3
+}
+
+// ParseRepeatMode is the inverse of RepeatMode.String, unknown strings are RepeatOff
+func ParseRepeatMode(s string) RepeatMode {
+	switch s {
+	case "all":
+		return RepeatAll
+	case "one":
+		return RepeatOne
+	default:
+		return RepeatOff
+	}
+}
+
+// playQueue holds the tracks the player works through and the order it
+// plays them in. order is a permutation of the indices of tracks, with
+// shuffle off it is just 0, 1, 2...
+// Shuffling never touches tracks.
+type playQueue struct {
+	tracks  []*Track
+	order   []int // indices into tracks, in play order
+	pos     int   // position in order of the current track, -1 before the first one
+	shuffle bool
+	repeat  RepeatMode
+	seed    uint64 // shuffled orders are derived from seed, so they are reproducible
+	cycle   uint64 // number of random sources derived from seed so far, see rng
+
+	// the current track was removed, pos points at the one before it
+	// so that next still continues where the removed track was
+	detached bool
+}
+
+func newPlayQueue(seed uint64) playQueue {
+	return playQueue{seed: seed, pos: -1}
+}
+
+// setSeed starts over with the random sources derived from seed, the
+// current order stays as it is
+func (q *playQueue) setSeed(seed uint64) {
+	q.seed, q.cycle = seed, 0
+}
+
+func (q *playQueue) set(tracks []*Track) {
+	q.tracks = tracks
+	q.pos = 0
+	q.detached = false
+	q.order = q.linearOrder()
+	if q.shuffle {
+		q.shuffleOrder(-1)
+	}
+	if q.empty() {
+		q.pos = -1
+	}
+}
+
+func (q *playQueue) empty() bool {
+	return len(q.tracks) == 0
+}
+
+// index of the current track in tracks, -1 if there is none
+func (q *playQueue) index() int {
+	if q.detached {
+		return -1
+	}
+	return q.anchor()
+}
+
+// anchor is the index in tracks that next continues from. It is the current
+// track, or the one before it if the current track was removed.
+func (q *playQueue) anchor() int {
+	if q.pos < 0 || q.pos >= len(q.order) {
+		return -1
+	}
+	return q.order[q.pos]
+}
+
+func (q *playQueue) current() *Track {
+	if i := q.index(); i != -1 {
+		return q.tracks[i]
+	}
+	return nil
+}
+
+// upcoming returns the indices of the tracks after the current one, in play order
+func (q *playQueue) upcoming() []int {
+	return slices.Clone(q.order[q.pos+1:])
+}
+
+// next moves to the track after the current one. At the end of the queue it
+// only wraps around with RepeatAll, otherwise ok is false and nothing changes.
+// A shuffled queue is shuffled again when it wraps, so every track is played
+// once before any track repeats.
+func (q *playQueue) next() (t *Track, ok bool) {
+	if q.empty() {
+		return nil, false
+	}
+	if q.pos >= len(q.order)-1 {
+		if q.repeat != RepeatAll {
+			return nil, false
+		}
+		if q.shuffle {
+			q.shuffleOrder(q.anchor())
+		}
+		q.pos = 0
+	} else {
+		q.pos++
+	}
+	q.detached = false
+	return q.current(), true
+}
+
+// afterEnd is the track to play once the current one finished on its own
+func (q *playQueue) afterEnd() (t *Track, ok bool) {
+	if q.repeat == RepeatOne && q.index() != -1 {
+		return q.current(), true
+	}
+	return q.next()
+}
+
+// peek returns up to n tracks that play after the current one, without moving.
+// With afterEnd it follows afterEnd instead of next, so RepeatOne gives the
+// current track. A shuffled queue is reshuffled when it wraps, so peek stops there.
+func (q *playQueue) peek(n int, afterEnd bool) []*Track {
+	if afterEnd && q.repeat == RepeatOne && q.index() != -1 {
+		return []*Track{q.current()}
+	}
+	var tracks []*Track
+	for i := 1; i <= len(q.order) && len(tracks) < n; i++ {
+		p := q.pos + i
+		if p >= len(q.order) {
+			if q.repeat != RepeatAll || q.shuffle {
+				break
+			}
+			p -= len(q.order)
+		}
+		tracks = append(tracks, q.tracks[q.order[p]])
+	}
+	return tracks
+}
+
+// previous moves to the track before the current one, it wraps around to the
+// end only with RepeatAll. At the start of the queue the first track is returned.
+// If the current track was removed, the track before it is the previous one.
+// Without one the removed track was at the start.
+func (q *playQueue) previous() *Track {
+	if q.empty() {
+		return nil
+	}
+	switch {
+	case q.detached && q.pos >= 0: // pos already is the track before the removed one
+	case q.pos > 0:
+		q.pos--
+	case q.repeat == RepeatAll:
+		q.pos = len(q.order) - 1
+	default:
+		q.pos = 0
+	}
+	q.detached = false
+	return q.current()
+}
+
+// setIndex makes tracks[i] the current track
+func (q *playQueue) setIndex(i int) {
+	for pos, idx := range q.order {
+		if idx == i {
+			q.pos = pos
+			q.detached = false
+			return
+		}
+	}
+}
+
+// setShuffle turns shuffle on or off without changing the current track.
+// Turning it on plays the rest of the queue in a random order, turning it
+// off continues in playlist order from the current track.
+func (q *playQueue) setShuffle(on bool) {
+	if q.shuffle == on {
+		return
+	}
+	q.shuffle = on
+	if q.empty() {
+		return
+	}
+	anchor := q.anchor()
+	q.order = q.linearOrder()
+	if !on {
+		q.pos = anchor
+		return
+	}
+	q.shuffleOrder(-1)
+	if anchor == -1 {
+		q.pos = -1
+		return
+	}
+	// the current track goes first so the whole rest of the queue is ahead of it
+	p := slices.Index(q.order, anchor)
+	q.order[0], q.order[p] = q.order[p], q.order[0]
+}
+
+// add appends tracks to the end of the queue. With shuffle on they are
+// mixed in somewhere among the tracks that haven't played yet.
+func (q *playQueue) add(tracks ...*Track) {
+	start := len(q.tracks)
+	q.tracks = append(q.tracks, tracks...)
+	q.reindex(func(i int) int { return i })
+	if !q.shuffle {
+		return
+	}
+	rng := q.rng()
+	for i := range tracks {
+		upcoming := len(q.order) - (q.pos + 1)
+		at := q.pos + 1 + rng.IntN(upcoming+1)
+		q.order = slices.Insert(q.order, at, start+i)
+	}
+}
+
+// insertNext puts tracks right after the current one, so they play next
+func (q *playQueue) insertNext(tracks ...*Track) {
+	at := q.anchor() + 1
+	q.tracks = slices.Insert(q.tracks, at, tracks...)
+	q.reindex(func(i int) int {
+		if i >= at {
+			return i + len(tracks)
+		}
+		return i
+	})
+	if !q.shuffle {
+		return
+	}
+	for i := range tracks {
+		q.order = slices.Insert(q.order, q.pos+1+i, at+i)
+	}
+}
+
+// remove takes tracks[i] out of the queue. Removing the current track
+// doesn't stop it, the queue continues with the track that came after it.
+func (q *playQueue) remove(i int) {
+	if i < 0 || i >= len(q.tracks) {
+		return
+	}
+	q.tracks = slices.Delete(q.tracks, i, i+1)
+	q.reindex(func(j int) int {
+		switch {
+		case j == i:
+			return -1
+		case j > i:
+			return j - 1
+		}
+		return j
+	})
+}
+
+// move moves tracks[from] to tracks[to]
+func (q *playQueue) move(from, to int) {
+	if from < 0 || from >= len(q.tracks) || to < 0 || to >= len(q.tracks) || from == to {
+		return
+	}
+	t := q.tracks[from]
+	q.tracks = slices.Insert(slices.Delete(q.tracks, from, from+1), to, t)
+	q.reindex(func(i int) int {
+		switch {
+		case i == from:
+			return to
+		case from < to && i > from && i <= to:
+			return i - 1
+		case to < from && i >= to && i < from:
+			return i + 1
+		}
+		return i
+	})
+}
+
+func (q *playQueue) clear() {
+	q.tracks = nil
+	q.order = nil
+	q.pos = -1
+	q.detached = false
+}
+
+// reindex fixes order and pos after tracks changed. newIndex maps an index
+// into the old tracks to the new one, or -1 if that track was removed.
+// Tracks that were added are not in order yet, unless shuffle is off.
+func (q *playQueue) reindex(newIndex func(int) int) {
+	order := make([]int, 0, len(q.order))
+	pos := -1
+	for p, old := range q.order {
+		i := newIndex(old)
+		if i == -1 {
+			if p == q.pos {
+				q.detached = true
+			}
+			continue
+		}
+		if p <= q.pos {
+			pos = len(order)
+		}
+		order = append(order, i)
+	}
+	if !q.shuffle {
+		// playlist order, follow the current track to its new index
+		if pos != -1 {
+			pos = order[pos]
+		}
+		order = q.linearOrder()
+	}
+	q.order, q.pos = order, pos
+}
+
+func (q *playQueue) linearOrder() []int {
+	order := make([]int, len(q.tracks))
+	for i := range order {
+		order[i] = i
+	}
+	return order
+}
+
+// rng is a new random source derived from seed. Every call gives another
+// one, so the same seed and the same edits give the same order.
+func (q *playQueue) rng() *rand.Rand {
+	q.cycle++
+	return rand.New(rand.NewPCG(q.seed, q.cycle))
+}
+
+// shuffleOrder puts order in a new random order and moves to the start.
+// If possible, avoid is not put first, so a track doesn't play twice in a row
+// when a shuffled queue wraps around.
+func (q *playQueue) shuffleOrder(avoid int) {
+	q.rng().Shuffle(len(q.order), func(i, j int) {
+		q.order[i], q.order[j] = q.order[j], q.order[i]
+	})
+	if len(q.order) > 1 && q.order[0] == avoid {
+		last := len(q.order) - 1
+		q.order[0], q.order[last] = q.order[last], q.order[0]
+	}
+	q.pos = 0
+}
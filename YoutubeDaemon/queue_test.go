@@ -0,0 +1,194 @@
+package daemon
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"ytt/YoutubeDaemon/yt"
+)
+
+func testTracks(n int) []*Track {
+	tracks := make([]*Track, n)
+	for i := range tracks {
+		tracks[i] = &Track{Entry: yt.Entry{ID: fmt.Sprint(i)}}
+	}
+	return tracks
+}
+
+func trackID(t *Track) string {
+	if t == nil {
+		return "-"
+	}
+	return t.ID
+}
+
+// queueOp does one thing to the queue, named like the playQueue method, and
+// returns the track it gives
+func queueOp(q *playQueue, op string) string {
+	if i, ok := strings.CutPrefix(op, "remove "); ok {
+		n, _ := strconv.Atoi(i)
+		q.remove(n)
+		return trackID(q.current())
+	}
+	switch op {
+	case "next":
+		t, _ := q.next()
+		return trackID(t)
+	case "end":
+		t, _ := q.afterEnd()
+		return trackID(t)
+	case "previous":
+		return trackID(q.previous())
+	case "current":
+		return trackID(q.current())
+	case "shuffle":
+		q.setShuffle(true)
+		return trackID(q.current())
+	case "unshuffle":
+		q.setShuffle(false)
+		return trackID(q.current())
+	}
+	panic("unknown op " + op)
+}
+
+func TestPlayQueue(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		tracks int
+		repeat RepeatMode
+		ops    string // queueOp ops, separated by commas
+		want   string // the tracks they give
+	}{
+		{"next to the end", 3, RepeatOff, "next, next, next, current", "1, 2, -, 2"},
+		{"next wraps with repeat all", 3, RepeatAll, "next, next, next", "1, 2, 0"},
+		{"repeat one replays after the end", 3, RepeatOne, "end, end, next, next, next", "0, 0, 1, 2, -"},
+		{"previous stops at the start", 3, RepeatOff, "next, previous, previous", "1, 0, 0"},
+		{"previous wraps with repeat all", 3, RepeatAll, "previous, previous", "2, 1"},
+		{"removing the current track detaches it", 4, RepeatOff, "next, remove 1, current, next, next", "1, -, -, 2, 3"},
+		{"repeat one moves on from a removed track", 3, RepeatOne, "next, remove 1, end", "1, -, 2"},
+		{"previous from a removed track", 4, RepeatOff, "next, next, remove 2, previous", "1, 2, -, 1"},
+		{"removing a track before the current one", 4, RepeatOff, "next, next, remove 0, current, previous", "1, 2, 2, 2, 1"},
+		// there is no track before it, so it is like being at the start
+		{"previous from a removed first track", 3, RepeatOff, "remove 0, previous", "-, 1"},
+		{"previous from a removed first track with repeat all", 3, RepeatAll, "remove 0, previous", "-, 2"},
+		{"next from a removed first track", 3, RepeatOff, "remove 0, next", "-, 1"},
+		{"removing the last track", 3, RepeatOff, "next, next, remove 2, next, previous", "1, 2, -, -, 1"},
+		{"shuffle keeps the current track", 5, RepeatOff, "next, shuffle, unshuffle, next", "1, 1, 1, 2"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newPlayQueue(1)
+			q.set(testTracks(tc.tracks))
+			q.repeat = tc.repeat
+			var got []string
+			for _, op := range strings.Split(tc.ops, ", ") {
+				got = append(got, queueOp(&q, op))
+			}
+			if got := strings.Join(got, ", "); got != tc.want {
+				t.Errorf("%s gave %s, want %s", tc.ops, got, tc.want)
+			}
+		})
+	}
+}
+
+// play takes n tracks from q with next, the ones it gets first
+func play(q *playQueue, n int) []string {
+	var ids []string
+	for range n {
+		t, ok := q.next()
+		if !ok {
+			break
+		}
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
+
+func TestPlayQueueShuffle(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		tracks int
+		start  int // track that is playing when shuffle goes on
+		repeat RepeatMode
+		wraps  bool // the queue is played around once more
+	}{
+		{"from the start", 10, 0, RepeatOff, false},
+		{"from the middle", 10, 4, RepeatOff, false},
+		{"wrapping around", 10, 4, RepeatAll, true},
+		{"two tracks wrapping around", 2, 0, RepeatAll, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			q := newPlayQueue(1)
+			q.set(testTracks(tc.tracks))
+			q.repeat = tc.repeat
+			q.setIndex(tc.start)
+			q.setShuffle(true)
+			if got := trackID(q.current()); got != fmt.Sprint(tc.start) {
+				t.Fatalf("shuffling changed the current track to %s", got)
+			}
+
+			// every other track once, then the end of the queue
+			rest := play(&q, tc.tracks-1)
+			all := append([]string{fmt.Sprint(tc.start)}, rest...)
+			slices.Sort(all)
+			if want := trackIDs(testTracks(tc.tracks)); !slices.Equal(all, want) {
+				t.Fatalf("played %v after %d, want the other tracks once", rest, tc.start)
+			}
+			last := rest[len(rest)-1]
+			if !tc.wraps {
+				if t2, ok := q.next(); ok {
+					t.Fatalf("next gave %s at the end of the queue", t2.ID)
+				}
+				return
+			}
+			// a new order, which doesn't start with the track that just played
+			again := play(&q, tc.tracks)
+			if again[0] == last {
+				t.Errorf("%s played twice in a row when the queue wrapped", last)
+			}
+			slices.Sort(again)
+			if want := trackIDs(testTracks(tc.tracks)); !slices.Equal(again, want) {
+				t.Errorf("played %v after wrapping, want every track once", again)
+			}
+		})
+	}
+}
+
+func trackIDs(tracks []*Track) []string {
+	var ids []string
+	for _, t := range tracks {
+		ids = append(ids, t.ID)
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func TestPlayQueueSeed(t *testing.T) {
+	order := func(seed uint64) []string {
+		q := newPlayQueue(seed)
+		q.set(testTracks(20))
+		q.setShuffle(true)
+		q.add(testTracks(5)...) // mixed in with the seeded source too
+		return append([]string{trackID(q.current())}, play(&q, 25)...)
+	}
+	if a, b := order(1), order(1); !slices.Equal(a, b) {
+		t.Errorf("the same seed shuffled %v and %v", a, b)
+	}
+	if a, b := order(1), order(2); slices.Equal(a, b) {
+		t.Errorf("seeds 1 and 2 both shuffled %v", a)
+	}
+
+	// setSeed starts over, like a queue that was just made with it
+	q := newPlayQueue(2)
+	q.set(testTracks(20))
+	q.setShuffle(true)
+	q.setShuffle(false)
+	q.setSeed(1)
+	q.setIndex(0)
+	q.setShuffle(true)
+	q.add(testTracks(5)...)
+	if got, want := append([]string{trackID(q.current())}, play(&q, 25)...), order(1); !slices.Equal(got, want) {
+		t.Errorf("after setSeed(1) shuffled %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,244 @@
+package daemon
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AudioSink plays what it reads from its source, 48kHz stereo float32 little
+// endian (bytesPerSecond). It starts out paused.
+type AudioSink interface {
+	Play()  // start or resume reading the source
+	Pause() // stop reading, keep what is buffered
+	Reset() // drop what is buffered and pause
+	SetVolume(volume float64)
+	BufferedSize() int // bytes read from the source that haven't been played yet
+	Close() error
+}
+
+// SinkOpener creates a sink that plays src
+type SinkOpener func(src io.Reader) (AudioSink, error)
+
+// ParseSink reads a sink from a spec like the config has it:
+//
+//	"oto" or ""   the sound card
+//	"null"        plays into the void, for running without a sound card
+//	"wav:<file>"  writes a wav file
+//	"raw:<file>"  writes raw samples to a file or fifo, "raw:-" is stdout (see SinkUsesStdout)
+func ParseSink(spec string) (SinkOpener, error) {
+	kind, path, _ := strings.Cut(spec, ":")
+	switch kind {
+	case "", "oto":
+		return openOtoSink, nil
+	case "null":
+		return func(src io.Reader) (AudioSink, error) {
+			return newPacedSink(src, nopWriteCloser{io.Discard}), nil
+		}, nil
+	case "wav", "raw":
+		if path == "" {
+			return nil, fmt.Errorf("audio sink %q needs a file, like %s:out.%s", kind, kind, kind)
+		}
+		return func(src io.Reader) (AudioSink, error) {
+			var w io.WriteCloser = nopWriteCloser{os.Stdout}
+			if path != "-" {
+				// a fifo blocks here until something reads it
+				f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+				if err != nil {
+					return nil, err
+				}
+				w = f
+			}
+			if kind == "wav" {
+				wav, err := newWavWriter(w)
+				if err != nil {
+					w.Close()
+					return nil, err
+				}
+				w = wav
+			}
+			return newPacedSink(src, w), nil
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown audio sink %q, use oto, null, wav:<file> or raw:<file>", spec)
+}
+
+// SinkUsesStdout tells if the sink of spec writes to stdout, the TUI has
+// to draw somewhere else then
+func SinkUsesStdout(spec string) bool {
+	kind, path, _ := strings.Cut(spec, ":")
+	return (kind == "wav" || kind == "raw") && path == "-"
+}
+
+// pacedSink reads its source in real time, as a sound card would, and
+// writes it to w
+type pacedSink struct {
+	src io.Reader
+	w   io.WriteCloser
+
+	mu      sync.Mutex
+	playing bool
+	volume  float64
+	wake    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	err     error // of the last write, returned by Close
+}
+
+// how often a paced sink reads its source
+const paceInterval = 20 * time.Millisecond
+
+func newPacedSink(src io.Reader, w io.WriteCloser) *pacedSink {
+	s := &pacedSink{
+		src:     src,
+		w:       w,
+		volume:  1,
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go s.run()
+	return s
+}
+
+func (s *pacedSink) run() {
+	defer close(s.stopped)
+	buf := make([]byte, 0, int(paceInterval.Seconds()*bytesPerSecond)*2)
+	var last time.Time
+	ticker := time.NewTicker(paceInterval)
+	defer ticker.Stop()
+	for {
+		s.mu.Lock()
+		playing, volume := s.playing, s.volume
+		s.mu.Unlock()
+		if !playing {
+			select {
+			case <-s.wake:
+				last = time.Now()
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-s.wake:
+			continue
+		case <-s.done:
+			return
+		}
+		// read as much as has played since last time, in whole frames
+		now := time.Now()
+		if now.Sub(last) > time.Second {
+			// the source kept us waiting, don't try to catch up
+			last = now.Add(-paceInterval)
+		}
+		n := int(now.Sub(last).Seconds()*bytesPerSecond) / frameSize * frameSize
+		last = last.Add(time.Duration(n) * time.Second / bytesPerSecond)
+		if cap(buf) < n {
+			buf = make([]byte, 0, n)
+		}
+		b := buf[:n]
+		if _, err := io.ReadFull(s.src, b); err != nil {
+			return // the mixer never fails, other sources end here
+		}
+		if volume != 1 {
+			for i := 0; i+4 <= len(b); i += 4 {
+				v := math.Float32frombits(binary.LittleEndian.Uint32(b[i:])) * float32(volume)
+				binary.LittleEndian.PutUint32(b[i:], math.Float32bits(v))
+			}
+		}
+		if _, err := s.w.Write(b); err != nil {
+			s.mu.Lock()
+			s.err = err
+			s.mu.Unlock()
+			publish(EventError{Err: fmt.Errorf("audio sink: %w", err)})
+			return
+		}
+	}
+}
+
+func (s *pacedSink) setPlaying(playing bool) {
+	s.mu.Lock()
+	s.playing = playing
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *pacedSink) Play()             { s.setPlaying(true) }
+func (s *pacedSink) Pause()            { s.setPlaying(false) }
+func (s *pacedSink) Reset()            { s.setPlaying(false) }
+func (s *pacedSink) BufferedSize() int { return 0 } // nothing is held back
+
+func (s *pacedSink) SetVolume(volume float64) {
+	s.mu.Lock()
+	s.volume = volume
+	s.mu.Unlock()
+}
+
+func (s *pacedSink) Close() error {
+	close(s.done)
+	<-s.stopped
+	err := s.w.Close()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return errors.Join(s.err, err)
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+// wavWriter writes a float wav file. The sizes in the header are only known
+// once it is closed, they are filled in then if the file can seek, otherwise
+// they stay at their maximum, which most tools read as "until the end".
+type wavWriter struct {
+	w    io.WriteCloser
+	size int64
+}
+
+func newWavWriter(w io.WriteCloser) (*wavWriter, error) {
+	_, err := w.Write(wavHeader(math.MaxUint32 - 36))
+	return &wavWriter{w: w}, err
+}
+
+func wavHeader(dataSize uint32) []byte {
+	h := make([]byte, 0, 44)
+	h = append(h, "RIFF"...)
+	h = binary.LittleEndian.AppendUint32(h, dataSize+36)
+	h = append(h, "WAVEfmt "...)
+	h = binary.LittleEndian.AppendUint32(h, 16)
+	h = binary.LittleEndian.AppendUint16(h, 3) // IEEE float
+	h = binary.LittleEndian.AppendUint16(h, outputChannels)
+	h = binary.LittleEndian.AppendUint32(h, outputRate)
+	h = binary.LittleEndian.AppendUint32(h, bytesPerSecond)
+	h = binary.LittleEndian.AppendUint16(h, frameSize)
+	h = binary.LittleEndian.AppendUint16(h, 32)
+	h = append(h, "data"...)
+	h = binary.LittleEndian.AppendUint32(h, dataSize)
+	return h
+}
+
+func (w *wavWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *wavWriter) Close() error {
+	if ws, ok := w.w.(io.WriteSeeker); ok && w.size <= math.MaxUint32-36 {
+		if _, err := ws.Seek(0, io.SeekStart); err == nil {
+			ws.Write(wavHeader(uint32(w.size)))
+		}
+	}
+	return w.w.Close()
+}
@@ -0,0 +1,14 @@
+//go:build nooto
+
+package daemon
+
+import (
+	"errors"
+	"io"
+)
+
+// built without a sound card backend, for headless machines that lack
+// the audio headers oto needs. Use the null, wav or raw sinks.
+func openOtoSink(src io.Reader) (AudioSink, error) {
+	return nil, errors.New("built without oto, there is no sound card sink")
+}
@@ -0,0 +1,59 @@
+//go:build !nooto
+
+package daemon
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/ebitengine/oto/v3"
+)
+
+// the oto context can only be made once per process
+var otoCtx struct {
+	once sync.Once
+	ctx  *oto.Context
+	err  error
+}
+
+// otoSink plays on the sound card
+type otoSink struct{ *oto.Player }
+
+func openOtoSink(src io.Reader) (AudioSink, error) {
+	otoCtx.once.Do(func() {
+		op := oto.NewContextOptions{
+			SampleRate:   48000,
+			ChannelCount: 2,
+			Format:       oto.FormatFloat32LE,
+		}
+		ctx, ready, err := oto.NewContext(&op)
+		if err != nil {
+			otoCtx.err = fmt.Errorf("could not initialize audio: %w", err)
+			return
+		}
+		<-ready
+		otoCtx.ctx = ctx
+	})
+	if otoCtx.err != nil {
+		return nil, otoCtx.err
+	}
+	return otoSink{otoCtx.ctx.NewPlayer(unseekable{src})}, nil
+}
+
+// unseekable lets oto seek a source that has no position, so Seek on the
+// player drops what it buffered without anything else happening
+type unseekable struct{ io.Reader }
+
+func (unseekable) Seek(offset int64, whence int) (int64, error) { return 0, nil }
+
+// Reset drops what is buffered and pauses. Player.Reset is deprecated, Seek
+// drops the buffer and keeps the player paused after Pause.
+func (s otoSink) Reset() {
+	s.Player.Pause()
+	s.Player.Seek(0, io.SeekCurrent)
+}
+
+func (s otoSink) Close() error {
+	return s.Player.Close()
+}
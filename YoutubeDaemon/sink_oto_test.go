@@ -0,0 +1,31 @@
+//go:build !nooto
+
+package daemon
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestOtoSinkReset(t *testing.T) {
+	s, err := openOtoSink(bytes.NewReader(make([]byte, bytesPerSecond)))
+	if err != nil {
+		t.Skip(err) // no sound card
+	}
+	defer s.Close()
+	s.Play()
+	for deadline := time.Now().Add(time.Second); s.BufferedSize() == 0; {
+		if time.Now().After(deadline) {
+			t.Skip("the player didn't buffer anything")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	s.Reset()
+	if n := s.BufferedSize(); n != 0 {
+		t.Errorf("%d bytes are still buffered after Reset", n)
+	}
+	if s.(otoSink).IsPlaying() {
+		t.Error("the player still plays after Reset")
+	}
+}
@@ -0,0 +1,326 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stream urls that expire within expiryMargin are resolved again before
+// playing, so they don't run out while the track plays
+const expiryMargin = 10 * time.Minute
+
+// streamURLExpiry reads the expire parameter of a googlevideo url,
+// it is the zero time if the url doesn't have one
+func streamURLExpiry(streamURL string) time.Time {
+	u, err := url.Parse(streamURL)
+	if err != nil {
+		return time.Time{}
+	}
+	expire := u.Query().Get("expire")
+	if expire == "" {
+		// some urls carry their parameters in the path, .../expire/1700000000/...
+		parts := strings.Split(u.Path, "/")
+		if i := slices.Index(parts, "expire"); i != -1 && i+1 < len(parts) {
+			expire = parts[i+1]
+		}
+	}
+	sec, err := strconv.ParseInt(expire, 10, 64)
+	if err != nil {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
+
+// streamURL is StreamingURL, or "" if it has to be resolved (again)
+func (t *Track) streamURL() string {
+	exp := streamURLExpiry(t.StreamingURL)
+	if !exp.IsZero() && time.Until(exp) < expiryMargin {
+		return ""
+	}
+	return t.StreamingURL
+}
+
+// streamSource reads a stream over http and seeks with range requests.
+// When the server says the url expired (403 or 410) it gets a new one from
+// refresh and carries on from the same byte. When the connection drops it
+// tries again, waiting longer after every failed attempt, and resumes where
+// it stopped.
+type streamSource struct {
+	ctx     context.Context
+	cancel  context.CancelFunc // Close cancels requests and retries
+	client  *http.Client
+	refresh func(context.Context) (string, error)
+
+	// backoff between reconnection attempts starts at minBackoff and doubles
+	// up to maxBackoff, after retries failed attempts Read gives up
+	minBackoff, maxBackoff time.Duration
+	retries                int
+
+	// called when the connection dropped and the source starts retrying,
+	// and when it got it back. Both can be nil.
+	buffering func(err error)
+	recovered func()
+
+	mu     sync.Mutex // the player manager reads url and closes the source
+	url    string
+	body   io.ReadCloser
+	closed bool
+
+	offset int64 // of the next byte Read returns
+	size   int64 // -1 until known
+}
+
+var (
+	errSourceClosed = errors.New("stream source closed")
+	errNoRange      = errors.New("server doesn't support range requests")
+)
+
+// statusError is an http response that isn't the stream
+type statusError struct {
+	Code   int
+	Status string
+}
+
+func (e statusError) Error() string {
+	return "stream request failed: " + e.Status
+}
+
+func newStreamSource(ctx context.Context, url string, refresh func(context.Context) (string, error)) *streamSource {
+	ctx, cancel := context.WithCancel(ctx)
+	return &streamSource{
+		ctx:        ctx,
+		cancel:     cancel,
+		client:     http.DefaultClient,
+		refresh:    refresh,
+		minBackoff: 250 * time.Millisecond,
+		maxBackoff: 8 * time.Second,
+		retries:    10,
+		url:        url,
+		size:       -1,
+	}
+}
+
+// URL of the stream, it changes when the source had to refresh it
+func (s *streamSource) URL() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.url
+}
+
+// open requests the stream from offset on
+func (s *streamSource) open() error {
+	refreshed := false
+	for {
+		u := s.URL()
+		if exp := streamURLExpiry(u); !refreshed && !exp.IsZero() && time.Now().After(exp) {
+			// no point asking, it is going to be a 403
+			if err := s.refreshURL(); err != nil {
+				return err
+			}
+			refreshed = true
+			continue
+		}
+		req, err := http.NewRequestWithContext(s.ctx, http.MethodGet, u, nil)
+		if err != nil {
+			return err
+		}
+		if s.offset > 0 {
+			req.Header.Set("Range", fmt.Sprintf("bytes=%d-", s.offset))
+		}
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return err
+		}
+		switch resp.StatusCode {
+		case http.StatusOK:
+			// a live stream just goes on from now, the demuxer finds the
+			// next page in it
+			if s.offset > 0 && s.size >= 0 {
+				resp.Body.Close()
+				return errNoRange
+			}
+			if s.offset == 0 {
+				s.size = resp.ContentLength
+			}
+		case http.StatusPartialContent:
+			if size, ok := contentRangeSize(resp.Header.Get("Content-Range")); ok {
+				s.size = size
+			}
+		case http.StatusRequestedRangeNotSatisfiable:
+			resp.Body.Close()
+			return io.EOF
+		case http.StatusForbidden, http.StatusGone:
+			resp.Body.Close()
+			if refreshed || s.refresh == nil {
+				return statusError{resp.StatusCode, resp.Status}
+			}
+			if err := s.refreshURL(); err != nil {
+				return err
+			}
+			refreshed = true
+			continue
+		default:
+			resp.Body.Close()
+			return statusError{resp.StatusCode, resp.Status}
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.closed {
+			resp.Body.Close()
+			return errSourceClosed
+		}
+		s.body = resp.Body
+		return nil
+	}
+}
+
+func (s *streamSource) refreshURL() error {
+	u, err := s.refresh(s.ctx)
+	if err != nil {
+		return fmt.Errorf("stream url expired, resolving it again: %w", err)
+	}
+	s.mu.Lock()
+	s.url = u
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *streamSource) Read(p []byte) (int, error) {
+	for {
+		s.mu.Lock()
+		body, closed := s.body, s.closed
+		s.mu.Unlock()
+		if closed {
+			return 0, errSourceClosed
+		}
+		if body == nil {
+			if s.size >= 0 && s.offset >= s.size {
+				return 0, io.EOF
+			}
+			if err := s.open(); err != nil {
+				if err := s.retry(err); err != nil {
+					return 0, err
+				}
+			}
+			continue
+		}
+		n, err := body.Read(p)
+		s.offset += int64(n)
+		if err == io.EOF && s.size >= 0 && s.offset < s.size {
+			err = io.ErrUnexpectedEOF // the server hung up early
+		}
+		if err == nil || err == io.EOF {
+			return n, err
+		}
+		// the connection dropped, the next read opens a new one from offset
+		s.dropBody()
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// retry keeps trying to open the stream after it failed with err,
+// until it works, the error is one that retrying won't fix, or it ran
+// out of attempts.
+func (s *streamSource) retry(err error) error {
+	if !s.retryable(err) {
+		return err
+	}
+	if s.buffering != nil {
+		s.buffering(err)
+	}
+	delay := s.minBackoff
+	for range s.retries {
+		select {
+		case <-s.ctx.Done():
+			return s.ctx.Err()
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, s.maxBackoff)
+		if err = s.open(); err == nil {
+			if s.recovered != nil {
+				s.recovered()
+			}
+			return nil
+		}
+		if !s.retryable(err) {
+			break
+		}
+	}
+	return fmt.Errorf("giving up on the stream: %w", err)
+}
+
+func (s *streamSource) retryable(err error) bool {
+	if s.ctx.Err() != nil || errors.Is(err, errSourceClosed) || errors.Is(err, errNoRange) || err == io.EOF {
+		return false
+	}
+	var status statusError
+	if errors.As(err, &status) {
+		return status.Code >= 500 || status.Code == http.StatusTooManyRequests
+	}
+	return true // network errors
+}
+
+func (s *streamSource) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += s.offset
+	case io.SeekEnd:
+		if s.size < 0 {
+			return 0, errors.New("seeking from the end of a stream of unknown size")
+		}
+		offset += s.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seeking before the start of the stream")
+	}
+	if offset != s.offset {
+		s.dropBody()
+		s.offset = offset
+	}
+	return offset, nil
+}
+
+// dropBody closes the current response, the next Read opens a new one
+func (s *streamSource) dropBody() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.body != nil {
+		s.body.Close()
+		s.body = nil
+	}
+}
+
+// Close stops the source, a Read that is waiting for the network returns
+func (s *streamSource) Close() error {
+	s.cancel()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.body == nil {
+		return nil
+	}
+	err := s.body.Close()
+	s.body = nil
+	return err
+}
+
+// contentRangeSize reads the total size from a "bytes 0-99/1234" header
+func contentRangeSize(h string) (int64, bool) {
+	_, total, ok := strings.Cut(h, "/")
+	if !ok || total == "*" {
+		return 0, false
+	}
+	size, err := strconv.ParseInt(total, 10, 64)
+	return size, err == nil
+}
@@ -0,0 +1,153 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer serves body with range requests. Its first response is cut
+// off after cutAt bytes by closing the connection, and the request after
+// that fails with a 503, so the source has to back off before it gets the
+// rest.
+type flakyServer struct {
+	body     []byte
+	cutAt    int
+	noRange  bool // ignore Range headers and always send everything
+	sized    bool // the cut response says its size in Content-Length, not just Content-Range
+	requests atomic.Int32
+}
+
+func (s *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch s.requests.Add(1) {
+	case 1:
+		s.cut(w, r)
+	case 2:
+		http.Error(w, "try again", http.StatusServiceUnavailable)
+	default:
+		if s.noRange {
+			r.Header.Del("Range")
+		}
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(s.body))
+	}
+}
+
+// cut answers r like ServeContent would, then hangs up halfway
+func (s *flakyServer) cut(w http.ResponseWriter, r *http.Request) {
+	start := 0
+	if _, err := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); err != nil {
+		start = 0
+	}
+	conn, buf, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+	if start == 0 {
+		fmt.Fprintf(buf, "HTTP/1.1 200 OK\r\n")
+	} else {
+		fmt.Fprintf(buf, "HTTP/1.1 206 Partial Content\r\n")
+		fmt.Fprintf(buf, "Content-Range: bytes %d-%d/%d\r\n", start, len(s.body)-1, len(s.body))
+	}
+	if s.sized {
+		fmt.Fprintf(buf, "Content-Length: %d\r\n", len(s.body)-start)
+	}
+	fmt.Fprintf(buf, "Connection: close\r\n\r\n")
+	buf.Write(s.body[start : start+s.cutAt])
+	buf.Flush()
+}
+
+func testBody(n int) []byte {
+	rng := rand.New(rand.NewPCG(1, 2))
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(rng.Uint32())
+	}
+	return b
+}
+
+func newTestSource(t *testing.T, url string) (s *streamSource, buffering, recovered *atomic.Int32) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	s = newStreamSource(ctx, url, nil)
+	s.minBackoff, s.maxBackoff = time.Millisecond, 10*time.Millisecond
+	buffering, recovered = new(atomic.Int32), new(atomic.Int32)
+	s.buffering = func(error) { buffering.Add(1) }
+	s.recovered = func() { recovered.Add(1) }
+	t.Cleanup(func() { s.Close() })
+	return s, buffering, recovered
+}
+
+func TestStreamSourceResumes(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		start int
+		sized bool
+	}{
+		{"dropped in the body", 0, true},
+		// without Content-Length the transport can't tell the body was cut
+		// short, the size from Content-Range has to
+		{"early eof", 1000, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			body := testBody(256 << 10)
+			srv := &flakyServer{body: body, cutAt: 100 << 10, sized: tc.sized}
+			ts := httptest.NewServer(srv)
+			defer ts.Close()
+
+			s, buffering, recovered := newTestSource(t, ts.URL)
+			if _, err := s.Seek(int64(tc.start), io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.open(); err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, body[tc.start:]) {
+				t.Fatalf("got %d bytes, want the %d bytes of the body from %d", len(got), len(body)-tc.start, tc.start)
+			}
+			if n := buffering.Load(); n != 1 {
+				t.Errorf("buffering called %d times, want 1", n)
+			}
+			if n := recovered.Load(); n != 1 {
+				t.Errorf("recovered called %d times, want 1", n)
+			}
+			if n := srv.requests.Load(); n != 3 {
+				t.Errorf("%d requests, want 3", n)
+			}
+		})
+	}
+}
+
+func TestStreamSourceNoRange(t *testing.T) {
+	srv := &flakyServer{body: testBody(64 << 10), cutAt: 10 << 10, sized: true, noRange: true}
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	s, _, recovered := newTestSource(t, ts.URL)
+	if err := s.open(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := io.ReadAll(s)
+	if !errors.Is(err, errNoRange) {
+		t.Fatalf("got %v, want %v", err, errNoRange)
+	}
+	if n := recovered.Load(); n != 0 {
+		t.Errorf("recovered called %d times, want 0", n)
+	}
+	// the cut request, the 503, then the one that ignored Range and gave up
+	if n := srv.requests.Load(); n != 3 {
+		t.Errorf("%d requests, want 3", n)
+	}
+}
@@ -0,0 +1,113 @@
+package daemon
+
+import (
+	"math"
+	"math/cmplx"
+	"sync/atomic"
+)
+
+// spectrumSize is how many samples go into one fft, at 48kHz that's 43ms
+// and 23Hz per bin
+const spectrumSize = 2048
+
+// the range Spectrum spreads its bands over
+const (
+	spectrumLow  = 40.0 // Hz
+	spectrumHigh = 16000.0
+	spectrumDB   = 60.0 // below full scale that shows as nothing
+)
+
+// pcmTap keeps the latest samples the mixer put out, downmixed to mono.
+// The mixer never waits on whoever reads it: every sample is an atomic of
+// its own, so a reader racing the mixer sees a few samples of the next
+// block at worst, which doesn't show in a spectrum.
+type pcmTap struct {
+	samples [spectrumSize * 2]atomic.Uint32 // float32 bits, a ring
+	written atomic.Uint64                   // samples written ever, only the mixer writes
+}
+
+var tap pcmTap
+
+func (t *pcmTap) write(frame *[outputChannels]float32) {
+	var sum float32
+	for _, v := range frame {
+		sum += v
+	}
+	n := t.written.Load()
+	t.samples[n%uint64(len(t.samples))].Store(math.Float32bits(sum / outputChannels))
+	t.written.Store(n + 1)
+}
+
+// latest fills dst with the last len(dst) samples, silence if there weren't
+// that many yet
+func (t *pcmTap) latest(dst []float32) {
+	n := t.written.Load()
+	for i := range dst {
+		at := n + uint64(i) - uint64(len(dst))
+		if at >= n { // wrapped below 0
+			dst[i] = 0
+			continue
+		}
+		dst[i] = math.Float32frombits(t.samples[at%uint64(len(t.samples))].Load())
+	}
+}
+
+// Spectrum fills bands with the spectrum of what the mixer played last, in
+// bands spaced logarithmically from 40Hz to 16kHz. Every band is from 0
+// (60dB below full scale or quieter) to 1 (a full scale sine).
+// It only reads the tap, so it can be called as often as needed without
+// getting in the way of playback.
+func Spectrum(bands []float64) {
+	samples := make([]float32, spectrumSize)
+	tap.latest(samples)
+	x := make([]complex128, spectrumSize)
+	for i, s := range samples {
+		hann := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/spectrumSize)
+		x[i] = complex(float64(s)*hann, 0)
+	}
+	fft(x)
+
+	binHz := float64(outputRate) / spectrumSize
+	// a full scale sine peaks at N/4 with a hann window
+	magnitude := func(k int) float64 { return cmplx.Abs(x[k]) * 4 / spectrumSize }
+	edge := func(i int) float64 {
+		return spectrumLow * math.Pow(spectrumHigh/spectrumLow, float64(i)/float64(len(bands)))
+	}
+	for i := range bands {
+		lo, hi := int(edge(i)/binHz), int(edge(i+1)/binHz)
+		peak := 0.0
+		// low bands are narrower than a bin, they get the closest one
+		for k := lo; k <= max(hi, lo); k++ {
+			peak = max(peak, magnitude(min(k, spectrumSize/2)))
+		}
+		db := 20 * math.Log10(max(peak, 1e-9))
+		bands[i] = max(0, min(1, (db+spectrumDB)/spectrumDB))
+	}
+}
+
+// fft transforms x in place, len(x) has to be a power of 2
+func fft(x []complex128) {
+	n := len(x)
+	// bit reversed order
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	for size := 2; size <= n; size <<= 1 {
+		step := cmplx.Exp(complex(0, -2*math.Pi/float64(size)))
+		for start := 0; start < n; start += size {
+			w := complex(1, 0)
+			for k := range size / 2 {
+				a, b := x[start+k], x[start+k+size/2]*w
+				x[start+k], x[start+k+size/2] = a+b, a-b
+				w *= step
+			}
+		}
+	}
+}
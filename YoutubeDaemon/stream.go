@@ -1,34 +1,111 @@
 package daemon
 
-// func beginStreaming(t Track, streamingURL string) {
-// 	mu.Lock()
-// 	if Player.close != nil {
-// 		Player.close()
-// 	}
-// 	mu.Unlock()
-
-// 	resp, err := http.Get(streamingURL)
-// 	if err != nil {
-// 		Player.Events <- EventErr(errors.Join(errors.New("failed to fetch streaming url"), err))
-// 		return
-// 	}
-// 	f := httprs.NewHttpReadSeeker(resp)
-
-// 	reader, _, err := newWebMReader(f)
-// 	if err != nil {
-// 		Player.Events <- EventErr(errors.Join(errors.New("failed to decode webm stream"), err))
-// 		go beginStreaming(t, streamingURL)
-// 		return
-// 	}
-// 	plr := otoCtx.NewPlayer(reader)
-// 	plr.Play()
-// 	mu.Lock()
-// 	defer mu.Unlock()
-// 	Player.plr = plr
-// 	Player.close = func() {
-// 		plr.Close()
-// 		f.Close()
-// 		reader.Close()
-// 	}
-// 	Player.Events <- EventTrackStarted(t)
-// }
+import (
+	"context"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+	"ytt/YoutubeDaemon/yt"
+)
+
+// how much audio a prefetched track decodes before it is played
+const prefetchBuffer = 3 * time.Second
+
+// a track that is being loaded in the background
+type trackLoad struct {
+	track  *Track
+	ctx    context.Context // also used for the stream once it is playing
+	cancel context.CancelFunc
+	loaded *CmdTrackLoaded // result of a prefetch that finished before the track was played
+}
+
+// close the stream of a prefetch that was never played
+func (l *trackLoad) discard() {
+	l.cancel()
+	if l.loaded != nil && l.loaded.reader != nil {
+		l.loaded.reader.Close()
+	}
+}
+
+// loadTrack resolves the stream url of t (unless streamingURL is already known)
+// and opens a decoder for it, decoding prebuffer of audio right away. The result
+// is sent back to the player manager as CmdTrackLoaded. Canceling ctx kills
+// yt-dlp and aborts the http request. Local tracks are opened straight away.
+func loadTrack(ctx context.Context, t *Track, streamingURL string, prebuffer time.Duration) {
+	loaded := CmdTrackLoaded{ctx: ctx, url: streamingURL}
+	if t.Local() {
+		loaded.reader, loaded.err = openFile(t.Path)
+	} else if loaded.url == "" {
+		loaded.url, loaded.err = yt.GetStreamURL(ctx, t.VideoURL)
+	}
+	if loaded.err == nil && !t.Local() {
+		var src *streamSource
+		loaded.reader, src, loaded.err = openStream(ctx, t, loaded.url)
+		if loaded.err == nil {
+			loaded.url = src.URL()
+		}
+	}
+	if loaded.err == nil && prebuffer > 0 {
+		if err := loaded.reader.fill(prebuffer); err != nil {
+			loaded.reader.Close()
+			loaded.reader, loaded.err = nil, err
+		}
+	}
+	cmdCh <- loaded
+}
+
+// streamPlaylist is the playlist of direct stream urls. They have nothing
+// for yt-dlp to resolve, the url is the stream.
+func streamPlaylist(urls []string) Playlist {
+	p := Playlist{List: yt.List{ID: "streams", Title: "Streams"}}
+	for _, u := range urls {
+		t := &Track{Entry: yt.Entry{ID: localID(u), Title: u}, StreamingURL: u}
+		if parsed, err := url.Parse(u); err == nil && parsed.Host != "" {
+			t.Uploader = parsed.Host
+			if name := strings.TrimSuffix(path.Base(parsed.Path), path.Ext(parsed.Path)); name != "." && name != "/" && name != "" {
+				t.Title = name
+			}
+		}
+		p.Tracks = append(p.Tracks, t)
+	}
+	return p
+}
+
+// resolveStreamURL looks up the stream url of t ahead of time, the result is
+// sent back as CmdStreamURLResolved
+func resolveStreamURL(ctx context.Context, t *Track) {
+	url, err := yt.GetStreamURL(ctx, t.VideoURL)
+	cmdCh <- CmdStreamURLResolved{t, url, err}
+}
+
+// openStream starts downloading url and decoding it. The download stops
+// when ctx is canceled or the reader is closed. If the url expires, the
+// source resolves the one of t again, direct streams have nothing to
+// resolve it from.
+func openStream(ctx context.Context, t *Track, url string) (*Reader, *streamSource, error) {
+	var refresh func(context.Context) (string, error)
+	if t.VideoURL != "" {
+		refresh = func(ctx context.Context) (string, error) {
+			url, err := yt.GetStreamURL(ctx, t.VideoURL)
+			if err == nil {
+				go func() { cmdCh <- CmdStreamURLResolved{t, url, nil} }()
+			}
+			return url, err
+		}
+	}
+	src := newStreamSource(ctx, url, refresh)
+	track := Track{Entry: t.Entry} // only the player manager touches the rest of t
+	src.buffering = func(err error) { publish(EventBuffering{track, err}) }
+	src.recovered = func() { publish(EventRecovered{track}) }
+	// open right away, so a bad url fails here and not somewhere in the parser
+	if err := src.open(); err != nil {
+		return nil, nil, err
+	}
+	r, err := newReader(src)
+	if err != nil {
+		src.Close()
+		return nil, nil, err
+	}
+	return r, src, nil
+}
@@ -0,0 +1,180 @@
+package daemon
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"sync"
+)
+
+// playback speed limits
+const (
+	MinSpeed = 0.5
+	MaxSpeed = 3.0
+)
+
+// wsola parameters, in frames at 48kHz
+const (
+	wsolaWindow = 1920            // 40ms segments
+	wsolaHop    = wsolaWindow / 2 // output advances by half a segment
+	wsolaSeek   = 480             // how far a segment may move to line up with the last one
+	wsolaStride = 4               // only every 4th frame is compared when lining up
+)
+
+// wsola changes the speed of stereo audio without changing its pitch
+// (waveform similarity overlap-add). It cuts the input into overlapping
+// segments that are taken further apart (faster) or closer together
+// (slower) than they are put back, and moves each one a little so its
+// waveform continues the previous one without phase jumps.
+type wsola struct {
+	mu      sync.Mutex
+	gen     int       // bumped by reset, input read before it is dropped
+	in      []float32 // stereo input that is still needed
+	pos     float64   // where the next segment ideally starts in in, in frames
+	natural int       // frame in in that would continue the last segment seamlessly, -1 before the first
+	acc     []float32 // overlap-add of the segments that aren't finished yet
+	out     []float32 // finished output
+	eof     bool
+	window  []float32
+	raw     []byte
+}
+
+func newWSOLA() *wsola {
+	w := &wsola{
+		natural: -1,
+		acc:     make([]float32, wsolaWindow*2),
+		window:  make([]float32, wsolaWindow),
+	}
+	// hann windows half a window apart add up to 1
+	for i := range w.window {
+		w.window[i] = float32(0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/wsolaWindow))
+	}
+	return w
+}
+
+// reset drops everything, for seeking
+func (w *wsola) reset() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.gen++
+	w.in, w.out = w.in[:0], w.out[:0]
+	clear(w.acc)
+	w.pos, w.natural, w.eof = 0, -1, false
+}
+
+// idle reports whether nothing went through w since it was made or reset
+func (w *wsola) idle() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.natural == -1 && len(w.in) == 0 && len(w.out) == 0 && !w.eof
+}
+
+// buffered is how much input hasn't made it to the output yet, in bytes
+// of input
+func (w *wsola) buffered(speed float64) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	frames := float64(len(w.in)/2) - w.pos + float64(len(w.out)/2)*speed
+	return max(int(frames), 0) * frameSize
+}
+
+// read fills p with audio from src played at speed
+func (w *wsola) read(p []byte, speed float64, src io.Reader) (int, error) {
+	for {
+		w.mu.Lock()
+		if n := min(len(p)/frameSize, len(w.out)/2); n > 0 || w.eof {
+			for i := range n * 2 {
+				binary.LittleEndian.PutUint32(p[i*4:], math.Float32bits(w.out[i]))
+			}
+			w.out = w.out[:copy(w.out, w.out[n*2:])]
+			w.mu.Unlock()
+			if n == 0 {
+				return 0, io.EOF
+			}
+			return n * frameSize, nil
+		}
+		if w.step(speed) {
+			w.mu.Unlock()
+			continue
+		}
+		gen := w.gen
+		w.mu.Unlock()
+
+		// src blocks until the decoder catches up, so it is read unlocked
+		if cap(w.raw) < wsolaHop*frameSize {
+			w.raw = make([]byte, wsolaHop*frameSize)
+		}
+		n, err := io.ReadFull(src, w.raw[:wsolaHop*frameSize])
+		w.mu.Lock()
+		if w.gen == gen {
+			for i := 0; i+4 <= n/frameSize*frameSize; i += 4 {
+				w.in = append(w.in, math.Float32frombits(binary.LittleEndian.Uint32(w.raw[i:])))
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				// what is still overlapping fades out, the rest is too
+				// short for a segment
+				w.out = append(w.out, w.acc[:wsolaHop*2]...)
+				clear(w.acc)
+				w.eof = true
+				err = nil
+			}
+		}
+		w.mu.Unlock()
+		if err != nil {
+			return 0, err
+		}
+	}
+}
+
+// step adds the next segment if there is enough input for it. w.mu is held.
+func (w *wsola) step(speed float64) bool {
+	frames := len(w.in) / 2
+	start := int(w.pos)
+	if start+wsolaSeek+wsolaWindow > frames || w.natural+wsolaWindow > frames {
+		return false
+	}
+	best := start
+	if w.natural >= 0 && speed != 1 {
+		best = w.align(max(start-wsolaSeek, 0), start+wsolaSeek)
+	}
+	for i := range wsolaWindow {
+		g := w.window[i]
+		w.acc[i*2] += w.in[(best+i)*2] * g
+		w.acc[i*2+1] += w.in[(best+i)*2+1] * g
+	}
+	w.out = append(w.out, w.acc[:wsolaHop*2]...)
+	copy(w.acc, w.acc[wsolaHop*2:])
+	clear(w.acc[wsolaHop*2:])
+	w.natural = best + wsolaHop
+	w.pos += wsolaHop * speed
+
+	// drop input no segment can reach anymore
+	if drop := min(int(w.pos)-wsolaSeek, w.natural); drop > 0 {
+		w.in = w.in[:copy(w.in, w.in[drop*2:])]
+		w.pos -= float64(drop)
+		w.natural -= drop
+	}
+	return true
+}
+
+// align finds the start between lo and hi whose segment looks the most
+// like what would naturally follow the last one
+func (w *wsola) align(lo, hi int) int {
+	best, bestScore := lo, math.Inf(-1)
+	for k := lo; k <= hi; k++ {
+		var dot, energy float64
+		for i := 0; i < wsolaWindow; i += wsolaStride {
+			a := float64(w.in[(w.natural+i)*2] + w.in[(w.natural+i)*2+1])
+			b := float64(w.in[(k+i)*2] + w.in[(k+i)*2+1])
+			dot += a * b
+			energy += b * b
+		}
+		if energy == 0 {
+			continue
+		}
+		if score := dot / math.Sqrt(energy); score > bestScore {
+			best, bestScore = k, score
+		}
+	}
+	return best
+}
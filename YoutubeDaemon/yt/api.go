@@ -2,6 +2,7 @@ package yt
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 )
@@ -12,7 +13,7 @@ func GetPlaylist(playlistID string) (List, error) {
 	if list, ok := loadFromCache(playlistID); ok {
 		return list, nil
 	}
-	stdout, stderr, err := runYtDLP(
+	stdout, stderr, err := runYtDLP(context.Background(),
 		"--flat-playlist", "--dump-single-json", ytPlaylistUrl+playlistID,
 	)
 	if stderr.Len() != 0 { // ytdlp error
@@ -29,11 +30,15 @@ func GetPlaylist(playlistID string) (List, error) {
 	saveToCache(p)
 	return p, nil
 }
-func GetStreamURL(videoURL string) (url string, err error) {
+func GetStreamURL(ctx context.Context, videoURL string) (url string, err error) {
 	// yt-dlp -f "bestaudio[ext=webm][acodec=opus]" -g
 	var stdout, stderr bytes.Buffer
-	stdout, stderr, err = runYtDLP(
+	stdout, stderr, err = runYtDLP(ctx,
 		"-f", "bestaudio[ext=webm][acodec=opus]", "-g", videoURL)
+	if ctx.Err() != nil { // killed, stderr is not interesting
+		err = ctx.Err()
+		return
+	}
 	if stderr.Len() != 0 { // ytdlp error
 		err = errors.New(stderr.String())
 		return
@@ -42,6 +47,10 @@ func GetStreamURL(videoURL string) (url string, err error) {
 		return
 	}
 	runes := []rune(stdout.String())
+	if len(runes) == 0 {
+		err = errors.New("yt-dlp did not return a stream url")
+		return
+	}
 	// the last character is a newline and that really messes things up
 	if runes[len(runes)-1] == '\n' {
 		runes = runes[:len(runes)-1]
@@ -102,3 +102,56 @@ func ClearCache() error {
 
 	return nil
 }
+
+// loudnessSubdir is where the loudness of videos is stored, next to the playlists
+var loudnessSubdir = filepath.Join(xdgCacheDir, "loudness")
+
+// Loudness of a video, measured while it played
+type Loudness struct {
+	Integrated float64 // LUFS
+	Peak       float64 // highest sample, 1 is full scale
+	Seconds    float64 // length of the audio that was measured
+}
+
+// LoadLoudness returns the loudness of a video and true if it was measured before
+func LoadLoudness(id string) (Loudness, bool) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	baseCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return Loudness{}, false
+	}
+	f, err := os.Open(filepath.Join(baseCacheDir, loudnessSubdir, id+".json"))
+	if err != nil {
+		return Loudness{}, false
+	}
+	defer f.Close()
+
+	var l Loudness
+	if err := json.NewDecoder(f).Decode(&l); err != nil {
+		return Loudness{}, false
+	}
+	return l, true
+}
+
+// SaveLoudness stores the loudness of a video
+func SaveLoudness(id string, l Loudness) error {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	baseCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return fmt.Errorf("could not determine cache directory: %w", err)
+	}
+	dir := filepath.Join(baseCacheDir, loudnessSubdir)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return fmt.Errorf("could not create cache directory: %w", err)
+	}
+	f, err := os.Create(filepath.Join(dir, id+".json"))
+	if err != nil {
+		return fmt.Errorf("could not create cache file: %w", err)
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(l)
+}
@@ -4,32 +4,37 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"os"
 	"os/exec"
 )
 
-var ytdlpPath string
-
 const (
 	xdgCacheDir = "ytt" // Cache directory that will be appended to the XDG cache directory.
 )
 
-var Ready = make(chan struct{})
+// Setup makes sure yt-dlp is there, downloading it if it's missing or the
+// wrong version. Commands do that on first use otherwise.
+func Setup(ctx context.Context) error {
+	_, err := executable(ctx)
+	return err
+}
 
-func init() {
-	go func() {
-		install, err := Install(context.TODO(), nil)
-		if err != nil {
-			fmt.Println("Error installing ytdlp", err)
-			os.Exit(1)
-		}
-		ytdlpPath = install.Executable
-		Ready <- struct{}{}
-	}()
+// executable is the path of yt-dlp, Install only looks for it once
+func executable(ctx context.Context) (string, error) {
+	install, err := Install(ctx, nil)
+	if err != nil {
+		return "", fmt.Errorf("installing yt-dlp: %w", err)
+	}
+	return install.Executable, nil
 }
-func runYtDLP(args ...string) (stdoutBuf, stderrBuf bytes.Buffer, err error) {
+
+// runYtDLP kills yt-dlp if ctx is canceled before it exits
+func runYtDLP(ctx context.Context, args ...string) (stdoutBuf, stderrBuf bytes.Buffer, err error) {
+	path, err := executable(ctx)
+	if err != nil {
+		return
+	}
 	args = append(args, "--quiet", "--no-warnings") // only errors in stderr
-	cmd := exec.Command(ytdlpPath, args...)
+	cmd := exec.CommandContext(ctx, path, args...)
 	// Return values
 	cmd.Stdout = &stdoutBuf
 	cmd.Stderr = &stderrBuf
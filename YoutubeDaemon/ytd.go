@@ -1,15 +1,11 @@
 package daemon
 
 import (
-	"log"
 	"ytt/YoutubeDaemon/yt"
-
-	"github.com/ebitengine/oto/v3"
 )
 
-var (
-	otoCtx *oto.Context
-)
+// size of one second of audio in the format the sinks play
+const bytesPerSecond = 48000 * 2 * 4
 
 // A playlist is just an ordered slice of Tracks
 type Playlist struct {
@@ -19,19 +15,29 @@ type Playlist struct {
 type Track struct {
 	yt.Entry
 	StreamingURL string
+	Path         string // of a local file, empty for youtube tracks
 }
 
-func init() {
-	op := oto.NewContextOptions{
-		SampleRate:   48000,
-		ChannelCount: 2,
-		Format:       oto.FormatFloat32LE,
-	}
+// Local reports whether t is a file instead of a youtube video
+func (t *Track) Local() bool {
+	return t.Path != ""
+}
+
+type PlayerState int
+
+const (
+	StateStopped PlayerState = iota
+	StatePlaying
+	StatePaused
+)
 
-	ctx, ready, err := oto.NewContext(&op)
-	if err != nil {
-		log.Fatal("could not initialize audio", err)
+func (s PlayerState) String() string {
+	switch s {
+	case StatePlaying:
+		return "playing"
+	case StatePaused:
+		return "paused"
+	default:
+		return "stopped"
 	}
-	<-ready
-	otoCtx=ctx
 }
@@ -8,6 +8,9 @@ import (
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
+	"time"
 	"ytt/YoutubeDaemon/yt"
 )
 
@@ -23,6 +26,12 @@ var (
 	Config         _config
 )
 
+// set by "ytt sleep", main hands them to the daemon
+var (
+	SleepTimer  time.Duration
+	SleepTracks int
+)
+
 func init() {
 	// make sure config directory exists
 	err := os.MkdirAll(configDir, 0755)
@@ -53,6 +62,8 @@ func HandleArgs(args ...string) (run bool) {
 		return false
 	case "add", "-a":
 		return AddPlaylists(args[1:])
+	case "sleep", "-s":
+		return SetSleep(args[1:])
 	default:
 		fmt.Println(HelpMessage)
 	}
@@ -82,6 +93,42 @@ func AddPlaylists(urls []string) bool {
 	fmt.Println("Added!")
 	return false
 }
+
+// SetSleep starts ytt with the sleep timer set. It takes a duration like
+// 1h30m, a number of minutes, "track" or a number of tracks like "3 tracks"
+// or "1 track".
+func SetSleep(args []string) (run bool) {
+	arg := strings.TrimSpace(strings.Join(args, " "))
+	if tracks, ok := sleepTracks(arg); ok {
+		SleepTracks = tracks
+		return true
+	} else if minutes, err := strconv.Atoi(arg); err == nil && minutes > 0 {
+		SleepTimer = time.Duration(minutes) * time.Minute
+		return true
+	} else if d, err := time.ParseDuration(arg); err == nil && d > 0 {
+		SleepTimer = d
+		return true
+	}
+	fmt.Printf("%q is not a sleep timer.\n", arg)
+	fmt.Println("Example: ", `ytt sleep 45m`, "or", `ytt sleep track`, "or", `ytt sleep 3 tracks`)
+	return false
+}
+
+// sleepTracks reads "track", "N track" or "N tracks", whatever N is
+func sleepTracks(arg string) (int, bool) {
+	n, ok := strings.CutSuffix(arg, "tracks")
+	if !ok {
+		if n, ok = strings.CutSuffix(arg, "track"); !ok {
+			return 0, false
+		}
+	}
+	n = strings.TrimSpace(n)
+	if n == "" {
+		return 1, true
+	}
+	tracks, err := strconv.Atoi(n)
+	return tracks, err == nil && tracks > 0
+}
 func OpenConfigDir() {
 	var cmd *exec.Cmd
 	path := configDir
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSetSleep(t *testing.T) {
+	for _, tc := range []struct {
+		arg    string
+		tracks int
+		timer  time.Duration
+		ok     bool
+	}{
+		{"track", 1, 0, true},
+		{"1 track", 1, 0, true},
+		{"1 tracks", 1, 0, true},
+		{"3 tracks", 3, 0, true},
+		{"3 track", 3, 0, true},
+		{"3tracks", 3, 0, true},
+		{"tracks", 1, 0, true},
+		{"0 tracks", 0, 0, false},
+		{"-2 tracks", 0, 0, false},
+		{"a few tracks", 0, 0, false},
+		{"45", 0, 45 * time.Minute, true},
+		{"1h30m", 0, 90 * time.Minute, true},
+		{"0", 0, 0, false},
+		{"later", 0, 0, false},
+	} {
+		SleepTracks, SleepTimer = 0, 0
+		ok := SetSleep(strings.Fields(tc.arg)) // split like the shell does
+		if ok != tc.ok || SleepTracks != tc.tracks || SleepTimer != tc.timer {
+			t.Errorf("SetSleep(%q) = %v with %d tracks and %v, want %v with %d tracks and %v",
+				tc.arg, ok, SleepTracks, SleepTimer, tc.ok, tc.tracks, tc.timer)
+		}
+	}
+	SleepTracks, SleepTimer = 0, 0
+}
@@ -16,6 +16,31 @@ type _config struct {
 	ThemeAccent         themes.Color
 	ThemeSelectionColor themes.Color
 	Playlists           []string //youtube playlist ids
+	Folders             []string // music folders, every one is played as a playlist
+	Streams             []string // urls of opus streams (icecast) or files, played as one playlist
+	Volume              int      // percent, 0-100
+	Muted               bool
+	Shuffle             bool
+	ShuffleSeed         int64              // shuffled orders come from it, picked on the first run
+	Repeat              string             // "off", "one" or "all"
+	Prefetch            int                // upcoming tracks to prepare while one plays, 0 turns it off
+	Crossfade           float64            // seconds the end of a track overlaps the next one, 0 is gapless, needs Prefetch above 0
+	AudioSink           string             // "oto" (sound card), "null", "wav:<file>" or "raw:<file>", see daemon.ParseSink
+	Speed               float64            // playback speed tracks start at
+	PlaylistSpeeds      map[string]float64 // speed by playlist id, for the ones that differ from Speed
+	Equalizer           bool
+	EqualizerPreset     string          // name of one of daemon.EQPresets, "custom" for EqualizerBands
+	EqualizerBands      []EqualizerBand // the "custom" preset, a [[EqualizerBands]] table for every band
+	Normalization       string          // loudness normalization, "off", "track" or "album"
+	TargetLoudness      float64         // LUFS that normalization aims for
+}
+
+// EqualizerBand is one band of the custom equalizer preset
+type EqualizerBand struct {
+	Type      string  // "peak" (the default), "lowshelf" or "highshelf"
+	Frequency float64 // Hz, the middle of a peak or the edge of a shelf
+	Gain      float64 // dB
+	Q         float64 // width, higher is narrower, 0 picks a default
 }
 
 func LoadConfig() {
@@ -25,6 +50,14 @@ func LoadConfig() {
 		fmt.Println("Error:", err)
 		return
 	}
+	// defaults for keys missing from the file
+	Config.Volume = 100
+	Config.Prefetch = 1
+	Config.AudioSink = "oto"
+	Config.Speed = 1
+	Config.EqualizerPreset = "flat"
+	Config.Normalization = "off"
+	Config.TargetLoudness = -14
 	toml.NewDecoder(file).Decode(&Config)
 }
 
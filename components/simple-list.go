@@ -183,6 +183,11 @@ func (m *List) MouseHovered(msg tea.MouseMsg) (ListEntry, bool) {
 	return ListEntry{}, false
 }
 
+// Searching reports whether the list takes typed keys for its search query
+func (m List) Searching() bool {
+	return m.isSearching
+}
+
 // return currently selected item
 func (m List) Hovered() (ListEntry, bool) {
 	start, end := m.paginator.GetSliceBounds(len(m.FilteredData))
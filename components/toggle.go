@@ -0,0 +1,22 @@
+package components
+
+import (
+	"ytt/themes"
+
+	"github.com/charmbracelet/lipgloss/v2"
+)
+
+// Toggle renders a label that is highlighted while on, and faint while off
+func Toggle(label string, on bool) string {
+	t := themes.Active()
+	style := lipgloss.NewStyle().
+		Background(t.Background).
+		Foreground(t.Foreground).
+		Faint(true)
+	if on {
+		style = style.
+			Faint(false).
+			Foreground(themes.AccentColor())
+	}
+	return style.Render(label)
+}
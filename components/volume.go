@@ -0,0 +1,34 @@
+package components
+
+import (
+	"fmt"
+	"strings"
+	"ytt/themes"
+
+	"github.com/charmbracelet/lipgloss/v2"
+	zone "github.com/lrstanley/bubblezone/v2"
+)
+
+const volumeBars = 10
+
+// VolumeZone is the zone id of the volume widget, scroll over it to change the volume
+const VolumeZone = "volume"
+
+// Volume renders a small volume meter, volume is in percent
+func Volume(volume int, muted bool) string {
+	t := themes.Active()
+	base := lipgloss.NewStyle().
+		Background(t.Background).
+		Foreground(t.Foreground)
+
+	filled := volume * volumeBars / 100
+	bars := base.Foreground(themes.AccentColor()).Render(strings.Repeat("▮", filled)) +
+		base.Faint(true).Render(strings.Repeat("▯", volumeBars-filled))
+
+	label := fmt.Sprintf(" %3d%%", volume)
+	if muted {
+		label = " mute"
+	}
+	o := base.Render("vol ") + bars + base.Render(label)
+	return zone.Mark(VolumeZone, o)
+}
@@ -33,6 +33,10 @@ func init() {
 	m.Entries = []Entry{
 		E("l", "Go to playlist picker"),
 		E("t", "Go to theme picker"),
+		E("u", "Go to queue"),
+		E("e", "Go to equalizer"),
+		E("z", "Set sleep timer"),
+		E("v", "Go to visualizer"),
 	}
 }
 
@@ -65,6 +69,14 @@ func gotoView(key string) tea.Cmd {
 		return views.Goto(views.ViewPlaylists)
 	case "t":
 		return views.Goto(views.ViewChangeTheme)
+	case "u":
+		return views.Goto(views.ViewQueue)
+	case "e":
+		return views.Goto(views.ViewEqualizer)
+	case "z":
+		return views.Goto(views.ViewSleep)
+	case "v":
+		return views.Goto(views.ViewVisualizer)
 	case "shift+d":
 		return views.Goto(views.ViewErrorLog)
 	}
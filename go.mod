@@ -10,7 +10,6 @@ require (
 	github.com/charmbracelet/x/ansi v0.8.0
 	github.com/ebitengine/oto/v3 v3.3.3
 	github.com/ebml-go/webm v0.0.0-20221117133942-84fa5245cf70
-	github.com/jfbus/httprs v1.0.1
 	github.com/lrstanley/bubblezone/v2 v2.0.0-alpha.1
 	github.com/mattn/go-runewidth v0.0.16
 	github.com/muesli/reflow v0.3.0
@@ -31,8 +30,6 @@ require (
 	github.com/ebml-go/ebml v0.0.0-20160925193348-ca8851a10894 // indirect
 	github.com/lucasb-eyer/go-colorful v1.2.0 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
-	github.com/mitchellh/copystructure v1.2.0 // indirect
-	github.com/mitchellh/reflectwalk v1.0.2 // indirect
 	github.com/muesli/cancelreader v0.2.2 // indirect
 	github.com/petar/GoLLRB v0.0.0-20130427215148-53be0d36a84c // indirect
 	github.com/rivo/uniseg v0.4.7 // indirect
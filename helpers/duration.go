@@ -0,0 +1,16 @@
+package helpers
+
+import (
+	"fmt"
+	"time"
+)
+
+// FormatDuration formats d like a media player does, 3:07 or 1:02:07
+func FormatDuration(d time.Duration) string {
+	d = max(d, 0).Round(time.Second)
+	h, m, s := int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%d:%02d", m, s)
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"math/rand/v2"
 	"os"
 	"time"
 	daemon "ytt/YoutubeDaemon"
+	"ytt/YoutubeDaemon/yt"
 	"ytt/cli"
 	"ytt/themes"
 
@@ -13,21 +16,35 @@ import (
 	zone "github.com/lrstanley/bubblezone/v2"
 )
 
-func ErrorWriter() {
+// LogWriter writes errors and info events to log.txt
+func LogWriter(sub *daemon.Subscription) {
 	logfile, err := os.OpenFile("log.txt", os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
 	if err != nil {
 		log.Fatal(fmt.Errorf("Could not create log file: %w", err))
 	}
-	for e := range daemon.Events() {
+	for e := range sub.C {
 		switch e := e.(type) {
-		case daemon.EventErr:
+		case daemon.EventError:
 			fmt.Fprintln(logfile, time.Now(), "ERROR:", e)
+		case daemon.EventLoadFailed:
+			fmt.Fprintln(logfile, time.Now(), "ERROR:", e.Track.Title, e.Err)
+		case daemon.EventBuffering:
+			fmt.Fprintln(logfile, time.Now(), "connection lost, retrying:", e.Track.Title, e.Err)
+		case daemon.EventRecovered:
+			fmt.Fprintln(logfile, time.Now(), "connection back:", e.Track.Title)
 		case daemon.EventInfo:
-			fmt.Fprintln(logfile, time.Now(), e)
+			fmt.Fprintln(logfile, time.Now(), e.Msg)
 		}
 	}
 }
 
+// forwardEvents hands the daemon's events to the TUI
+func forwardEvents(program *tea.Program, sub *daemon.Subscription) {
+	for e := range sub.C {
+		program.Send(e)
+	}
+}
+
 func main() {
 	if cli.Run() == false {
 		return
@@ -39,17 +56,83 @@ func main() {
 	for _, id := range cli.Config.Playlists {
 		ids = append(ids, id)
 	}
+	sink, err := daemon.ParseSink(cli.Config.AudioSink)
+	if err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
+	if len(cli.Config.EqualizerBands) > 0 {
+		var bands []daemon.EQBand
+		for i, b := range cli.Config.EqualizerBands {
+			typ, err := daemon.ParseEQBandType(b.Type)
+			if err != nil {
+				fmt.Printf("Error: equalizer band %d: %v\n", i+1, err)
+				os.Exit(1)
+			}
+			bands = append(bands, daemon.EQBand{Type: typ, Freq: b.Frequency, Gain: b.Gain, Q: b.Q})
+		}
+		if err := daemon.AddCustomEQPreset(bands); err != nil {
+			fmt.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
+	// yt-dlp would be downloaded on first use otherwise, with the TUI up
+	if err := yt.Setup(context.Background()); err != nil {
+		fmt.Println("Error:", err)
+		os.Exit(1)
+	}
 	daemon.InitDaemon()
+	go LogWriter(daemon.Subscribe(64, daemon.DropOldest))
+	// subscribe before registering anything or touching the player. Folders
+	// are scanned in the background, the TUI has to see the playlists they
+	// turn into as well as the settings below.
+	events := daemon.Subscribe(256, daemon.Coalesce)
 	daemon.RegisterPlaylists(ids...)
+	daemon.RegisterFolders(cli.Config.Folders...)
+	daemon.RegisterStreams(cli.Config.Streams...)
 	themes.Wait()
-	go ErrorWriter()
 	themes.Activate(cli.Config.ThemeName)
 	themes.Selection = cli.Config.ThemeAccent
 	themes.Accent = cli.Config.ThemeAccent
-	if _, err := tea.NewProgram(Model(),
+	options := []tea.ProgramOption{
 		tea.WithAltScreen(),
 		tea.WithMouseAllMotion(),
-	).Run(); err != nil {
+	}
+	if daemon.SinkUsesStdout(cli.Config.AudioSink) {
+		// the audio goes to stdout, so the TUI draws on the terminal itself
+		tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error: the audio sink writes to stdout and there is no terminal for the TUI:", err)
+			os.Exit(1)
+		}
+		defer tty.Close()
+		options = append(options, tea.WithOutput(tty))
+	}
+	program := tea.NewProgram(Model(), options...)
+	go forwardEvents(program, events)
+	daemon.SetSink(sink)
+	daemon.SetVolume(cli.Config.Volume)
+	daemon.SetMuted(cli.Config.Muted)
+	if cli.Config.ShuffleSeed == 0 {
+		cli.Config.ShuffleSeed = rand.Int64()
+		cli.Config.Save()
+	}
+	daemon.SetShuffleSeed(uint64(cli.Config.ShuffleSeed))
+	daemon.SetShuffle(cli.Config.Shuffle)
+	daemon.SetRepeat(daemon.ParseRepeatMode(cli.Config.Repeat))
+	daemon.SetPrefetch(cli.Config.Prefetch)
+	daemon.SetCrossfade(time.Duration(cli.Config.Crossfade * float64(time.Second)))
+	daemon.SetDefaultSpeeds(cli.Config.Speed, cli.Config.PlaylistSpeeds)
+	daemon.SetEqualizerPreset(cli.Config.EqualizerPreset)
+	daemon.SetEqualizer(cli.Config.Equalizer)
+	daemon.SetNormalization(daemon.ParseNormalizationMode(cli.Config.Normalization), cli.Config.TargetLoudness)
+	switch {
+	case cli.SleepTimer > 0:
+		daemon.SleepTimer(cli.SleepTimer)
+	case cli.SleepTracks > 0:
+		daemon.StopAfter(cli.SleepTracks)
+	}
+	if _, err := program.Run(); err != nil {
 		fmt.Println("Error running program:", err)
 		os.Exit(1)
 	}
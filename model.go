@@ -5,10 +5,14 @@ package main
 
 import (
 	"time"
+	daemon "ytt/YoutubeDaemon"
+	"ytt/cli"
+	"ytt/components"
 	menu "ytt/globalmenu"
 	"ytt/helpers"
 	"ytt/views"
 
+	"github.com/charmbracelet/bubbles/v2/spinner"
 	tea "github.com/charmbracelet/bubbletea/v2"
 	zone "github.com/lrstanley/bubblezone/v2"
 )
@@ -20,6 +24,11 @@ func Model() tea.Model {
 		playlistView:    views.Playlist(),
 		changeThemeView: views.ChangeTheme(),
 		tracksView:      views.TracksModel{},
+		queueView:       views.Queue(),
+		equalizerView:   views.Equalizer(),
+		sleepView:       views.Sleep(),
+		visualizerView:  views.Visualizer(),
+		nowPlaying:      views.NowPlaying(),
 
 		menuOpened:   true,
 		openAtCenter: true,
@@ -30,6 +39,11 @@ type model struct {
 	playlistView    views.PlaylistModel
 	changeThemeView views.ChangeThemeModel
 	tracksView      views.TracksModel
+	queueView       views.QueueModel
+	equalizerView   views.EqualizerModel
+	sleepView       views.SleepModel
+	visualizerView  views.VisualizerModel
+	nowPlaying      views.NowPlayingModel
 
 	width, height    int
 	view             views.ViewMsg // active view
@@ -39,9 +53,12 @@ type model struct {
 }
 
 func (m model) Init() tea.Cmd {
-	return tea.Every(time.Millisecond*16, func(t time.Time) tea.Msg {
-		return TickMsg{}
-	})
+	return tea.Batch(
+		tea.Every(time.Millisecond*16, func(t time.Time) tea.Msg {
+			return TickMsg{}
+		}),
+		views.VisualizerFrame(),
+	)
 }
 
 func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -51,13 +68,31 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.WindowSizeMsg:
 		m.width, m.height = msg.Width, msg.Height
 		menu.Update(msg)
+		m.nowPlaying, _ = m.nowPlaying.Update(msg)
+		// the views get what is left above the now playing bar
+		msg.Height -= views.NowPlayingHeight
 		m.playlistView, _ = m.playlistView.Update(msg)
 		m.tracksView, _ = m.tracksView.Update(msg)
 		m.changeThemeView, _ = m.changeThemeView.Update(msg)
+		m.queueView, _ = m.queueView.Update(msg)
+		m.equalizerView, _ = m.equalizerView.Update(msg)
+		m.sleepView, _ = m.sleepView.Update(msg)
+		m.visualizerView, _ = m.visualizerView.Update(msg)
+		return m, nil
 
 	case TickMsg:
 		return m, CmdTick
+	case views.VisualizerFrameMsg:
+		// the spectrum is only worth computing while it's visible
+		if m.view == views.ViewVisualizer {
+			m.visualizerView, _ = m.visualizerView.Update(msg)
+		}
+		return m, views.VisualizerFrame()
 	case tea.MouseClickMsg:
+		if msg.Button == tea.MouseLeft && helpers.ZoneCollision(zone.Get(views.NowPlayingZone), msg) {
+			m.nowPlaying, cmd = m.nowPlaying.Update(msg)
+			return m, cmd
+		}
 		if msg.Button == tea.MouseRight {
 			m.openAtCenter = false
 			m.menuOpened = !m.menuOpened
@@ -71,24 +106,123 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		}
 		// Playlists and Tracks views have to close the playlist click menu [views.PlaylistMenu]
 		m.updateViews(msg)
+	case tea.MouseWheelMsg:
+		if helpers.ZoneCollision(zone.Get(components.VolumeZone), msg) {
+			switch msg.Button {
+			case tea.MouseWheelUp:
+				go daemon.ChangeVolume(5)
+			case tea.MouseWheelDown:
+				go daemon.ChangeVolume(-5)
+			}
+			return m, nil // don't scroll the list underneath
+		}
 	case tea.KeyMsg:
+		if !m.menuOpened && m.searching() && msg.String() != "ctrl+c" {
+			break // typed into the search query of the list
+		}
 		switch msg.String() {
 		case " ", "space":
 			m.openAtCenter = true
 			m.menuOpened = !m.menuOpened
 		case "esc":
 			m.menuOpened = false
+		case ">":
+			go daemon.PlayNextTrack()
+		case "<":
+			go daemon.PlayPreviousTrack()
+		case "p":
+			go daemon.TogglePause()
+		case "shift+left":
+			go daemon.Seek(-5 * time.Second)
+		case "shift+right":
+			go daemon.Seek(5 * time.Second)
+		case "ctrl+left":
+			go daemon.Seek(-30 * time.Second)
+		case "ctrl+right":
+			go daemon.Seek(30 * time.Second)
+		case "+", "=":
+			go daemon.ChangeVolume(5)
+		case "-":
+			go daemon.ChangeVolume(-5)
+		case "[":
+			go daemon.ChangeSpeed(-0.25)
+		case "]":
+			go daemon.ChangeSpeed(0.25)
+		case "\\":
+			go daemon.SetSpeed(1)
+		case "m":
+			go daemon.ToggleMute()
+		case "s":
+			go daemon.ToggleShuffle()
+		case "r":
+			go daemon.CycleRepeat()
+		case "x":
+			if m.nowPlaying.Loading() {
+				go daemon.CancelLoad()
+			}
+		case "0", "1", "2", "3", "4", "5", "6", "7", "8", "9":
+			percent := float64(msg.String()[0]-'0') * 10
+			go daemon.SeekPercent(percent)
 		case "q", "ctrl+c":
 			return m, tea.Quit
 		}
 
+	case daemon.EventLoading, daemon.EventTrackStarted, daemon.EventLoadCanceled,
+		daemon.EventLoadFailed, daemon.EventProgress, daemon.EventBuffering,
+		daemon.EventRecovered, spinner.TickMsg:
+		m.nowPlaying, cmd = m.nowPlaying.Update(msg)
+		return m, cmd
+	case daemon.EventPlaylistsChanged:
+		// folders are scanned in the background, their playlists come in late
+		m.playlistView, _ = m.playlistView.Update(msg)
+		return m, nil
+	case daemon.EventQueueChanged:
+		// the queue view keeps up with the queue even when it's not visible
+		m.queueView, _ = m.queueView.Update(msg)
+		return m, nil
+	case daemon.EventStateChanged, daemon.EventSpeedChanged:
+		m.nowPlaying, _ = m.nowPlaying.Update(msg)
+		m.visualizerView, _ = m.visualizerView.Update(msg)
+		return m, nil
+	case daemon.EventShuffleChanged:
+		m.nowPlaying, _ = m.nowPlaying.Update(msg)
+		if cli.Config.Shuffle != msg.Shuffle {
+			cli.Config.Shuffle = msg.Shuffle
+			cli.Config.Save()
+		}
+		return m, nil
+	case daemon.EventRepeatChanged:
+		m.nowPlaying, _ = m.nowPlaying.Update(msg)
+		if cli.Config.Repeat != msg.Repeat.String() {
+			cli.Config.Repeat = msg.Repeat.String()
+			cli.Config.Save()
+		}
+		return m, nil
+	case daemon.EventSleepChanged:
+		m.nowPlaying, _ = m.nowPlaying.Update(msg)
+		m.sleepView, _ = m.sleepView.Update(msg)
+		return m, nil
+	case daemon.EventEqualizerChanged:
+		m.equalizerView, _ = m.equalizerView.Update(msg)
+		if cli.Config.Equalizer != msg.Enabled || cli.Config.EqualizerPreset != msg.Preset {
+			cli.Config.Equalizer, cli.Config.EqualizerPreset = msg.Enabled, msg.Preset
+			cli.Config.Save()
+		}
+		return m, nil
+	case daemon.EventVolumeChanged:
+		m.nowPlaying, _ = m.nowPlaying.Update(msg)
+		if cli.Config.Volume != msg.Volume || cli.Config.Muted != msg.Muted {
+			cli.Config.Volume, cli.Config.Muted = msg.Volume, msg.Muted
+			cli.Config.Save()
+		}
+		return m, nil
 	case views.ViewMsg:
 		m.view = msg
 		m.menuOpened = false
 		return m, cmd
 	case views.ReinitTracksModelMsg:
 		m.tracksView = views.NewTracksModel(msg.Playlist)
-		m.tracksView, _ = m.tracksView.Update(tea.WindowSizeMsg{Width: m.width, Height: m.height})
+		m.tracksView, _ = m.tracksView.Update(tea.WindowSizeMsg{Width: m.width, Height: m.height - views.NowPlayingHeight})
 		m.view = views.ViewTracks
 		m.menuOpened = false
 	}
@@ -108,9 +242,36 @@ func (m *model) updateViews(msg tea.Msg) (cmd tea.Cmd) {
 		m.tracksView, cmd = m.tracksView.Update(msg)
 	case views.ViewChangeTheme:
 		m.changeThemeView, cmd = m.changeThemeView.Update(msg)
+	case views.ViewQueue:
+		m.queueView, cmd = m.queueView.Update(msg)
+	case views.ViewEqualizer:
+		m.equalizerView, cmd = m.equalizerView.Update(msg)
+	case views.ViewSleep:
+		m.sleepView, cmd = m.sleepView.Update(msg)
+	case views.ViewVisualizer:
+		m.visualizerView, cmd = m.visualizerView.Update(msg)
 	}
 	return
 }
+
+// searching reports whether the active view has a list that takes typed keys
+// for its search query, the single key shortcuts would eat them
+func (m model) searching() bool {
+	switch m.view {
+	case views.ViewPlaylists:
+		return m.playlistView.Searching()
+	case views.ViewTracks:
+		return m.tracksView.Searching()
+	case views.ViewChangeTheme:
+		return m.changeThemeView.Searching()
+	case views.ViewEqualizer:
+		return m.equalizerView.Searching()
+	case views.ViewSleep:
+		return m.sleepView.Searching()
+	}
+	return false
+}
+
 func (m model) visibleView() string {
 	var content string
 
@@ -121,12 +282,21 @@ func (m model) visibleView() string {
 		content = m.changeThemeView.View()
 	case views.ViewTracks:
 		content = m.tracksView.View()
+	case views.ViewQueue:
+		content = m.queueView.View()
+	case views.ViewEqualizer:
+		content = m.equalizerView.View()
+	case views.ViewSleep:
+		content = m.sleepView.View()
+	case views.ViewVisualizer:
+		content = m.visualizerView.View()
 	}
 	return content
 }
 func (m model) View() (view string) {
 	content := m.visibleView()
 	view = content
+	view = helpers.PlaceOverlay(0, m.height-views.NowPlayingHeight, m.nowPlaying.View(), view)
 	// view, _ = helpers.Overlay(view, content, 0, 0, true)
 	if m.menuOpened { // render menu as an overlay
 		if m.openAtCenter {
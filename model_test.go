@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+	"ytt/views"
+
+	tea "github.com/charmbracelet/bubbletea/v2"
+)
+
+func key(r rune) tea.KeyPressMsg {
+	return tea.KeyPressMsg{Code: r, Text: string(r)}
+}
+
+func quits(cmd tea.Cmd) bool {
+	if cmd == nil {
+		return false
+	}
+	_, ok := cmd().(tea.QuitMsg)
+	return ok
+}
+
+func TestHotkeysTypeIntoSearch(t *testing.T) {
+	eq, _ := views.Equalizer().Update(tea.WindowSizeMsg{Width: 80, Height: 24})
+	var m tea.Model = model{view: views.ViewEqualizer, equalizerView: eq}
+
+	m, _ = m.Update(key('/'))
+	m, cmd := m.Update(key('q'))
+	if quits(cmd) {
+		t.Fatal("q quit while typing a search query")
+	}
+	if got := m.(model).equalizerView.Searching(); !got {
+		t.Fatal("the list stopped searching")
+	}
+
+	m, _ = m.Update(key('/')) // done searching
+	if _, cmd := m.Update(key('q')); !quits(cmd) {
+		t.Fatal("q didn't quit after the search")
+	}
+}
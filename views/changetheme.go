@@ -144,6 +144,21 @@ func (m ChangeThemeModel) Update(msg tea.Msg) (ChangeThemeModel, tea.Cmd) {
 	}
 	return m, cmd
 }
+
+// Searching reports whether the list of the open tab takes typed keys for
+// its search query
+func (m ChangeThemeModel) Searching() bool {
+	switch m.tabcontent[m.selectedTab] {
+	case "Themes":
+		return m.themeslist.Searching()
+	case "Accent Color":
+		return m.accentsList.Searching()
+	case "Selection Color":
+		return m.selectionList.Searching()
+	}
+	return false
+}
+
 func (m ChangeThemeModel) View() string {
 	var o string
 	t := themes.Active()
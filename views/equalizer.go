@@ -0,0 +1,115 @@
+package views
+
+import (
+	daemon "ytt/YoutubeDaemon"
+	"ytt/components"
+	"ytt/helpers"
+	"ytt/themes"
+
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss/v2"
+	zone "github.com/lrstanley/bubblezone/v2"
+)
+
+// EqualizerToggleZone is the zone id of the on/off switch of the equalizer view
+const EqualizerToggleZone = "eqToggle"
+
+// EqualizerModel picks the equalizer preset and turns it on and off.
+// It follows EventEqualizerChanged, so it shows what the daemon uses.
+type EqualizerModel struct {
+	presets       components.List
+	enabled       bool
+	width, height int // height is the list's, without the status line
+}
+
+func Equalizer() EqualizerModel {
+	var rows []components.ListEntry
+	for _, p := range daemon.EQPresets {
+		rows = append(rows, components.ListEntry{
+			Name: p.Name,
+			Desc: p.Description(),
+		})
+	}
+	return EqualizerModel{presets: components.NewList(rows, "Equalizer presets")}
+}
+
+func (m EqualizerModel) Update(msg tea.Msg) (EqualizerModel, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		// the list gets what is left above the status line
+		m.width, m.height = msg.Width, max(msg.Height-statusHeight, 1)
+		m.presets, cmd = m.presets.Update(tea.WindowSizeMsg{Width: m.width, Height: m.height})
+		return m, cmd
+	case daemon.EventEqualizerChanged:
+		m.enabled = msg.Enabled
+		m.presets.SelectedName = msg.Preset
+		return m, nil
+	case tea.MouseClickMsg:
+		if msg.Button != tea.MouseLeft {
+			break
+		}
+		if helpers.ZoneCollision(zone.Get(EqualizerToggleZone), msg) {
+			send(daemon.ToggleEqualizer)
+		} else if active, ok := m.presets.MouseHovered(msg); ok {
+			m.pick(active)
+		}
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "e":
+			if !m.presets.Searching() {
+				send(daemon.ToggleEqualizer)
+			}
+		case "enter":
+			if active, ok := m.presets.Hovered(); ok {
+				m.pick(active)
+			}
+		}
+	}
+	m.presets, cmd = m.presets.Update(msg)
+	return m, cmd
+}
+
+// Searching reports whether the preset list takes typed keys for its search query
+func (m EqualizerModel) Searching() bool {
+	return m.presets.Searching()
+}
+
+// picking a preset turns the equalizer on, that's what one would expect
+func (m *EqualizerModel) pick(active components.ListEntry) {
+	send(func() {
+		daemon.SetEqualizerPreset(active.Name)
+		daemon.SetEqualizer(true)
+	})
+}
+
+// statusHeight is the status line under the equalizer and sleep timer
+// lists, with the blank line above it
+const statusHeight = 2
+
+func (m EqualizerModel) View() string {
+	t := themes.Active()
+	base := lipgloss.NewStyle().
+		Background(t.Background)
+	label := "off"
+	if m.enabled {
+		label = "on"
+	}
+	status := base.
+		Foreground(t.Foreground).
+		PaddingTop(1).
+		PaddingLeft(4).
+		Width(m.width).
+		Render("Equalizer is " +
+			zone.Mark(EqualizerToggleZone, components.Toggle(label, m.enabled)) +
+			base.Foreground(t.Foreground).Faint(true).Render(" · e to switch it, enter to pick a preset"))
+	listStyle := base.
+		Width(m.width).
+		Height(m.height).
+		MaxHeight(m.height). // a short terminal would push the status line under the now playing bar
+		PaddingLeft(2)
+	return base.Render(lipgloss.JoinVertical(0,
+		listStyle.Render(m.presets.View()),
+		status,
+	))
+}
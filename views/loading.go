@@ -0,0 +1,29 @@
+package views
+
+import (
+	daemon "ytt/YoutubeDaemon"
+	"ytt/themes"
+
+	"github.com/charmbracelet/lipgloss/v2"
+	"github.com/charmbracelet/x/ansi"
+	zone "github.com/lrstanley/bubblezone/v2"
+)
+
+// CancelLoadZone is the zone id of the cancel button shown while a track loads
+const CancelLoadZone = "cancelLoad"
+
+// Loading renders the "loading track" line with a cancel button
+func Loading(spinner string, t daemon.Track) string {
+	th := themes.Active()
+	base := lipgloss.NewStyle().
+		Background(th.Background).
+		Foreground(th.Foreground)
+
+	title := ansi.Truncate(t.Title, 40, "…")
+	cancel := base.
+		Foreground(themes.SelectionColor()).
+		Render("[x cancel]")
+	return base.Foreground(themes.AccentColor()).Render(spinner) +
+		base.Render(" Loading "+title+" ") +
+		zone.Mark(CancelLoadZone, cancel)
+}
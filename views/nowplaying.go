@@ -0,0 +1,196 @@
+package views
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	daemon "ytt/YoutubeDaemon"
+	"ytt/components"
+	"ytt/helpers"
+	"ytt/themes"
+
+	"github.com/charmbracelet/bubbles/v2/spinner"
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss/v2"
+	"github.com/charmbracelet/x/ansi"
+	zone "github.com/lrstanley/bubblezone/v2"
+)
+
+const (
+	// NowPlayingHeight is the number of lines the now playing bar takes at the bottom of the screen
+	NowPlayingHeight = 2
+	// NowPlayingZone is the zone id of the whole bar, clicks on it don't reach the views
+	NowPlayingZone = "nowPlaying"
+	// ProgressZone is the zone id of the progress bar, click it to seek
+	ProgressZone = "progress"
+)
+
+// NowPlayingModel is the bar at the bottom of every view. It follows the
+// daemon events, the root model passes them on.
+type NowPlayingModel struct {
+	width     int
+	track     *daemon.Track // track that is playing, or was last played
+	elapsed   time.Duration
+	duration  time.Duration
+	state     daemon.PlayerState
+	shuffle   bool
+	repeat    daemon.RepeatMode
+	volume    int // percent
+	muted     bool
+	speed     float64
+	sleep     daemon.EventSleepChanged
+	loading   *daemon.Track // track the daemon is loading, nil if none
+	buffering bool          // the stream of track lost its connection
+	spinner   spinner.Model
+}
+
+func NowPlaying() NowPlayingModel {
+	return NowPlayingModel{
+		volume:  100,
+		speed:   1,
+		spinner: spinner.New(spinner.WithSpinner(spinner.Dot)),
+	}
+}
+
+// Loading reports whether a track is being loaded
+func (m NowPlayingModel) Loading() bool {
+	return m.loading != nil
+}
+
+func (m NowPlayingModel) Update(msg tea.Msg) (NowPlayingModel, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width = msg.Width
+	case daemon.EventLoading:
+		t := daemon.Track(msg)
+		spinning := m.loading != nil || m.buffering
+		m.loading = &t
+		if !spinning {
+			cmd = m.spinner.Tick
+		}
+	case daemon.EventBuffering:
+		if m.track != nil && msg.Track.ID == m.track.ID {
+			if !m.buffering && m.loading == nil {
+				cmd = m.spinner.Tick
+			}
+			m.buffering = true
+		}
+	case daemon.EventRecovered:
+		if m.track != nil && msg.Track.ID == m.track.ID {
+			m.buffering = false
+		}
+	case daemon.EventLoadCanceled, daemon.EventLoadFailed:
+		m.loading = nil
+	case daemon.EventTrackStarted:
+		t := daemon.Track(msg)
+		m.track, m.loading = &t, nil
+		m.buffering = false
+		m.elapsed = 0
+		m.duration = time.Duration(t.DurationSeconds) * time.Second
+	case daemon.EventProgress:
+		m.elapsed = msg.Elapsed
+		if msg.Duration > 0 {
+			m.duration = msg.Duration
+		}
+	case daemon.EventStateChanged:
+		m.state = msg.State
+		if m.state == daemon.StateStopped {
+			m.elapsed = 0
+			m.buffering = false
+		}
+	case daemon.EventShuffleChanged:
+		m.shuffle = msg.Shuffle
+	case daemon.EventRepeatChanged:
+		m.repeat = msg.Repeat
+	case daemon.EventVolumeChanged:
+		m.volume, m.muted = msg.Volume, msg.Muted
+	case daemon.EventSpeedChanged:
+		m.speed = msg.Speed
+	case daemon.EventSleepChanged:
+		m.sleep = msg
+	case spinner.TickMsg:
+		if m.loading != nil || m.buffering { // otherwise stop ticking
+			m.spinner, cmd = m.spinner.Update(msg)
+		}
+	case tea.MouseClickMsg:
+		if msg.Button != tea.MouseLeft {
+			break
+		}
+		if m.loading != nil && helpers.ZoneCollision(zone.Get(CancelLoadZone), msg) {
+			send(daemon.CancelLoad)
+		}
+		z := zone.Get(ProgressZone)
+		if m.track != nil && m.duration > 0 && helpers.ZoneCollision(z, msg) {
+			frac := float64(msg.X-z.StartX) / float64(max(z.EndX-z.StartX, 1))
+			pos := time.Duration(frac * float64(m.duration))
+			send(func() { daemon.SeekTo(pos) })
+		}
+	}
+	return m, cmd
+}
+
+func (m NowPlayingModel) View() string {
+	t := themes.Active()
+	base := lipgloss.NewStyle().
+		Background(t.Background).
+		Foreground(t.Foreground)
+	width := max(m.width-2, 0) // one column of padding on both sides
+
+	var status string
+	if m.sleep.On {
+		status = components.Toggle(SleepLabel(m.sleep)+" ", true)
+	}
+	status += components.Toggle(strconv.FormatFloat(m.speed, 'g', -1, 64)+"× ", m.speed != 1) +
+		components.Toggle("shuffle ", m.shuffle) +
+		components.Toggle(fmt.Sprintf("repeat %s ", m.repeat), m.repeat != daemon.RepeatOff) +
+		components.Volume(m.volume, m.muted)
+
+	var info string
+	switch {
+	case m.loading != nil:
+		info = Loading(m.spinner.View(), *m.loading)
+	case m.track != nil:
+		icon := "■"
+		switch {
+		case m.buffering:
+			icon = m.spinner.View()
+		case m.state == daemon.StatePlaying:
+			icon = "▶"
+		case m.state == daemon.StatePaused:
+			icon = "⏸"
+		}
+		room := max(width-lipgloss.Width(status)-3, 0)
+		title := ansi.Truncate(m.track.Title, room, "…")
+		uploader := ansi.Truncate(" · "+m.track.Uploader, max(room-ansi.StringWidth(title), 0), "…")
+		info = base.Foreground(themes.AccentColor()).Render(icon+" ") +
+			base.Bold(true).Render(title) +
+			base.Faint(true).Render(uploader)
+	default:
+		info = base.Faint(true).Render("nothing playing")
+	}
+	gap := max(width-lipgloss.Width(info)-lipgloss.Width(status), 1)
+	top := info + base.Render(strings.Repeat(" ", gap)) + status
+
+	elapsed := helpers.FormatDuration(m.elapsed)
+	total := "-:--"
+	if m.duration > 0 {
+		total = helpers.FormatDuration(m.duration)
+	}
+	barWidth := max(width-len(elapsed)-len(total)-2, 0)
+	filled := 0
+	if m.duration > 0 {
+		filled = min(int(float64(barWidth)*float64(m.elapsed)/float64(m.duration)), barWidth)
+	}
+	bar := base.Foreground(themes.AccentColor()).Render(strings.Repeat("━", filled)) +
+		base.Faint(true).Render(strings.Repeat("─", barWidth-filled))
+	bottom := base.Render(elapsed+" ") + zone.Mark(ProgressZone, bar) + base.Render(" "+total)
+
+	o := base.
+		Width(m.width).
+		PaddingLeft(1).
+		PaddingRight(1).
+		Render(top + "\n" + bottom)
+	return zone.Mark(NowPlayingZone, o)
+}
@@ -74,16 +74,19 @@ func handleMenuOptionsSelected(opt string) {
 
 }
 func Playlist() PlaylistModel {
+	list := components.NewList(playlistRows(daemon.GetRegisteredPlaylists()), "Playlists")
+	return PlaylistModel{list: list}
+}
+func playlistRows(playlists []daemon.Playlist) []components.ListEntry {
 	var rows []components.ListEntry
-	for _, p := range daemon.GetRegisteredPlaylists() {
+	for _, p := range playlists {
 		var r components.ListEntry
 		r.Name = p.Title
 		r.Desc = p.Channel
 		r.CustomData = p
 		rows = append(rows, r)
 	}
-	list := components.NewList(rows[:], "Playlists")
-	return PlaylistModel{list: list}
+	return rows
 }
 func updatePlaylistMenuByReadingKeyboard(keyCode rune) {
 	switch keyCode {
@@ -102,6 +105,9 @@ func (m PlaylistModel) Update(msg tea.Msg) (PlaylistModel, tea.Cmd) {
 	switch msg := msg.(type) {
 	case tea.WindowSizeMsg:
 		m.width, m.height = msg.Width, msg.Height
+	case daemon.EventPlaylistsChanged:
+		// the list picks the new rows up below, the cursor stays where it is
+		m.list.AllData = playlistRows(msg.Playlists)
 	case tea.KeyMsg:
 		switch msg.Key().Code {
 		case tea.KeyEsc:
@@ -119,7 +125,8 @@ func (m PlaylistModel) Update(msg tea.Msg) (PlaylistModel, tea.Cmd) {
 			} else {
 				opt := PlaylistMenu.Options[PlaylistMenu.selectedOption]
 				if opt == "Play" {
-					go daemon.PlayPlaylist(PlaylistMenu.selectedPlaylist)
+					p := PlaylistMenu.selectedPlaylist
+					send(func() { daemon.PlayPlaylist(p) })
 					m.showingMenu = false
 				} else if opt == "View tracks" {
 					m.showingMenu = false
@@ -158,7 +165,8 @@ func (m PlaylistModel) Update(msg tea.Msg) (PlaylistModel, tea.Cmd) {
 				z := zone.Get(opt)
 				if helpers.ZoneCollision(z, msg) { // make sure the button was clicked
 					if opt == "Play" {
-						go daemon.PlayPlaylist(PlaylistMenu.selectedPlaylist)
+						p := PlaylistMenu.selectedPlaylist
+						send(func() { daemon.PlayPlaylist(p) })
 						m.showingMenu = false
 					} else if opt == "View tracks" {
 						m.showingMenu = false
@@ -184,6 +192,12 @@ func (m PlaylistModel) Update(msg tea.Msg) (PlaylistModel, tea.Cmd) {
 	}
 	return m, cmd
 }
+
+// Searching reports whether the playlist list takes typed keys for its search query
+func (m PlaylistModel) Searching() bool {
+	return m.list.Searching()
+}
+
 func (m PlaylistModel) View() string {
 	var o string
 	t := themes.Active()
@@ -0,0 +1,230 @@
+package views
+
+import (
+	"fmt"
+	"slices"
+	"time"
+	daemon "ytt/YoutubeDaemon"
+	"ytt/helpers"
+	"ytt/themes"
+
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss/v2"
+	"github.com/charmbracelet/x/ansi"
+	zone "github.com/lrstanley/bubblezone/v2"
+)
+
+const (
+	queueZonePrefix       = "queue"
+	queueRemoveZonePrefix = "queueRemove"
+)
+
+// QueueModel shows the play queue, entries can be reordered, removed and jumped to
+type QueueModel struct {
+	width, height int
+	tracks        []*daemon.Track
+	current       int   // index of the playing track, -1 if none
+	upcoming      []int // indices of the tracks still to play, in play order
+	cursor        int
+	offset        int // index of the first visible entry
+
+	// mouse press that is waiting for its release
+	pressed         int  // entry the mouse went down on, -1 if none
+	pressedRemove   bool // on its remove button
+	pressedSelected bool // on the entry under the cursor, clicking it again plays it
+}
+
+func Queue() QueueModel {
+	return QueueModel{current: -1, pressed: -1}
+}
+
+func (m QueueModel) Update(msg tea.Msg) (QueueModel, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+	case daemon.EventQueueChanged:
+		m.tracks, m.current, m.upcoming = msg.Tracks, msg.Index, msg.Upcoming
+	case tea.KeyMsg:
+		switch msg.String() {
+		case "up", "k":
+			m.cursor--
+		case "down", "j":
+			m.cursor++
+		case "shift+up", "K":
+			if from := m.cursor; from > 0 && from < len(m.tracks) {
+				send(func() { daemon.MoveInQueue(from, from-1) })
+				m.cursor--
+			}
+		case "shift+down", "J":
+			if from := m.cursor; from < len(m.tracks)-1 {
+				send(func() { daemon.MoveInQueue(from, from+1) })
+				m.cursor++
+			}
+		case "d", "delete":
+			if i := m.cursor; i < len(m.tracks) {
+				send(func() { daemon.RemoveFromQueue(i) })
+			}
+		case "enter":
+			if i := m.cursor; i < len(m.tracks) {
+				send(func() { daemon.PlayFromQueue(i) })
+			}
+		}
+	// actions happen on release, the root model can deliver a click twice
+	case tea.MouseClickMsg:
+		if msg.Button != tea.MouseLeft {
+			break
+		}
+		m.pressed, m.pressedRemove = -1, false
+		if i, ok := m.removeHovered(msg); ok {
+			m.pressed, m.pressedRemove = i, true
+		} else if i, ok := m.entryHovered(msg); ok {
+			m.pressed, m.pressedSelected = i, i == m.cursor
+		}
+	case tea.MouseMotionMsg:
+		// the cursor follows an entry being dragged
+		if m.pressed != -1 && !m.pressedRemove {
+			if i, ok := m.entryHovered(msg); ok {
+				m.cursor = i
+			}
+		}
+	case tea.MouseReleaseMsg:
+		if m.pressed == -1 {
+			break
+		}
+		from := m.pressed
+		m.pressed = -1
+		if m.pressedRemove {
+			if i, ok := m.removeHovered(msg); ok && i == from {
+				send(func() { daemon.RemoveFromQueue(i) })
+			}
+			break
+		}
+		i, ok := m.entryHovered(msg)
+		switch {
+		case !ok:
+		case i != from: // dropped on another entry
+			send(func() { daemon.MoveInQueue(from, i) })
+			m.cursor = i
+		case m.pressedSelected:
+			send(func() { daemon.PlayFromQueue(i) })
+		default:
+			m.cursor = i
+		}
+	case tea.MouseWheelMsg:
+		switch msg.Button {
+		case tea.MouseWheelUp:
+			m.offset--
+			m.cursor--
+		case tea.MouseWheelDown:
+			m.offset++
+			m.cursor++
+		}
+	}
+	m.clamp()
+	return m, nil
+}
+
+// number of entries that fit on screen
+func (m QueueModel) rows() int {
+	return max(m.height-5, 1) // padding, title, stats and blank lines
+}
+
+// clamp keeps the cursor on an entry and the cursor on screen
+func (m *QueueModel) clamp() {
+	m.cursor = min(max(m.cursor, 0), max(len(m.tracks)-1, 0))
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	}
+	if m.cursor >= m.offset+m.rows() {
+		m.offset = m.cursor - m.rows() + 1
+	}
+	m.offset = min(max(m.offset, 0), max(len(m.tracks)-m.rows(), 0))
+}
+
+func (m QueueModel) visible() (start, end int) {
+	return m.offset, min(m.offset+m.rows(), len(m.tracks))
+}
+
+func (m QueueModel) entryHovered(msg tea.MouseMsg) (int, bool) {
+	start, end := m.visible()
+	for i := start; i < end; i++ {
+		if helpers.ZoneCollision(zone.Get(fmt.Sprint(queueZonePrefix, i)), msg) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func (m QueueModel) removeHovered(msg tea.MouseMsg) (int, bool) {
+	start, end := m.visible()
+	for i := start; i < end; i++ {
+		if helpers.ZoneCollision(zone.Get(fmt.Sprint(queueRemoveZonePrefix, i)), msg) {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+func (m QueueModel) View() string {
+	t := themes.Active()
+	base := lipgloss.NewStyle().
+		Background(t.Background).
+		Foreground(t.Foreground)
+
+	title := base.
+		Foreground(themes.AccentColor()).
+		Underline(true).
+		Render("Queue")
+
+	var total, left time.Duration
+	for i, tr := range m.tracks {
+		d := time.Duration(tr.DurationSeconds) * time.Second
+		total += d
+		if i == m.current || slices.Contains(m.upcoming, i) {
+			left += d
+		}
+	}
+	stats := base.Faint(true).Render(fmt.Sprintf("%d tracks · %s total · %s left",
+		len(m.tracks), helpers.FormatDuration(total), helpers.FormatDuration(left)))
+
+	var list string
+	if len(m.tracks) == 0 {
+		list = base.Faint(true).Render("nothing queued, pick a playlist or add some tracks") + "\n"
+	}
+	start, end := m.visible()
+	numWidth := len(fmt.Sprint(len(m.tracks)))
+	for i := start; i < end; i++ {
+		tr := m.tracks[i]
+		style := base
+		marker := "  "
+		switch {
+		case i == m.current:
+			style = style.Foreground(themes.AccentColor()).Bold(true)
+			marker = "▶ "
+		case !slices.Contains(m.upcoming, i): // already played
+			style = style.Faint(true)
+		}
+		cursor := base.Render(" ")
+		if i == m.cursor {
+			cursor = base.Foreground(t.CursorColor).Render("│")
+			if i != m.current {
+				style = style.Foreground(themes.SelectionColor())
+			}
+		}
+		row := style.Render(fmt.Sprintf("%s%*d. %-41s %-20s %7s",
+			marker, numWidth, i+1,
+			ansi.Truncate(tr.Title, 40, "…"),
+			ansi.Truncate(tr.Uploader, 20, "…"),
+			helpers.FormatDuration(time.Duration(tr.DurationSeconds)*time.Second)))
+		remove := base.Faint(true).Render(" ✕")
+		list += cursor + zone.Mark(fmt.Sprint(queueZonePrefix, i), row) +
+			zone.Mark(fmt.Sprint(queueRemoveZonePrefix, i), remove) + "\n"
+	}
+
+	return base.
+		Width(m.width).
+		Height(m.height).
+		PaddingTop(1).
+		PaddingLeft(2).
+		Render(title + "\n" + stats + "\n\n" + list)
+}
@@ -0,0 +1,135 @@
+package views
+
+import (
+	"fmt"
+	"time"
+	daemon "ytt/YoutubeDaemon"
+	"ytt/components"
+	"ytt/helpers"
+	"ytt/themes"
+
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss/v2"
+)
+
+// sleepOption is what picking an entry of the sleep view sets, one of
+// timer and tracks is 0, both are for turning it off
+type sleepOption struct {
+	timer  time.Duration
+	tracks int
+}
+
+var sleepOptions = []components.ListEntry{
+	{Name: "off", Desc: "keep playing", CustomData: sleepOption{}},
+	{Name: "15 minutes", Desc: "pause in 15 minutes", CustomData: sleepOption{timer: 15 * time.Minute}},
+	{Name: "30 minutes", Desc: "pause in 30 minutes", CustomData: sleepOption{timer: 30 * time.Minute}},
+	{Name: "45 minutes", Desc: "pause in 45 minutes", CustomData: sleepOption{timer: 45 * time.Minute}},
+	{Name: "1 hour", Desc: "pause in an hour", CustomData: sleepOption{timer: time.Hour}},
+	{Name: "2 hours", Desc: "pause in two hours", CustomData: sleepOption{timer: 2 * time.Hour}},
+	{Name: "this track", Desc: "stop when the current track ends", CustomData: sleepOption{tracks: 1}},
+	{Name: "3 tracks", Desc: "stop after 3 tracks, counting the current one", CustomData: sleepOption{tracks: 3}},
+	{Name: "5 tracks", Desc: "stop after 5 tracks, counting the current one", CustomData: sleepOption{tracks: 5}},
+}
+
+// SleepModel sets the sleep timer. It follows EventSleepChanged, so it
+// shows what the daemon uses.
+type SleepModel struct {
+	options       components.List
+	sleep         daemon.EventSleepChanged
+	width, height int // height is the list's, without the status line
+}
+
+func Sleep() SleepModel {
+	m := SleepModel{options: components.NewList(sleepOptions, "Sleep timer")}
+	m.options.SelectedName = "off"
+	return m
+}
+
+func (m SleepModel) Update(msg tea.Msg) (SleepModel, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		// the list gets what is left above the status line
+		m.width, m.height = msg.Width, max(msg.Height-statusHeight, 1)
+		m.options, cmd = m.options.Update(tea.WindowSizeMsg{Width: m.width, Height: m.height})
+		return m, cmd
+	case daemon.EventSleepChanged:
+		m.sleep = msg
+		if !msg.On {
+			m.options.SelectedName = "off"
+		}
+		return m, nil
+	case tea.MouseClickMsg:
+		if msg.Button != tea.MouseLeft {
+			break
+		}
+		if active, ok := m.options.MouseHovered(msg); ok {
+			m.pick(active)
+		}
+	case tea.KeyMsg:
+		if msg.String() == "enter" {
+			if active, ok := m.options.Hovered(); ok {
+				m.pick(active)
+			}
+		}
+	}
+	m.options, cmd = m.options.Update(msg)
+	return m, cmd
+}
+
+// Searching reports whether the option list takes typed keys for its search query
+func (m SleepModel) Searching() bool {
+	return m.options.Searching()
+}
+
+func (m *SleepModel) pick(active components.ListEntry) {
+	m.options.SelectedName = active.Name
+	o := active.CustomData.(sleepOption)
+	if o.tracks > 0 {
+		send(func() { daemon.StopAfter(o.tracks) })
+	} else {
+		send(func() { daemon.SleepTimer(o.timer) })
+	}
+}
+
+// SleepLabel is a short description of the sleep timer, like "sleep 12:34",
+// empty if it is off
+func SleepLabel(s daemon.EventSleepChanged) string {
+	switch {
+	case !s.On:
+		return ""
+	case s.Tracks == 0 || s.Remaining > 0:
+		return "sleep " + helpers.FormatDuration(s.Remaining)
+	case s.Tracks == 1:
+		return "sleep after track"
+	default:
+		return fmt.Sprintf("sleep in %d tracks", s.Tracks)
+	}
+}
+
+func (m SleepModel) View() string {
+	t := themes.Active()
+	base := lipgloss.NewStyle().
+		Background(t.Background)
+	label := "off"
+	if m.sleep.On {
+		label = SleepLabel(m.sleep)
+	}
+	status := base.
+		Foreground(t.Foreground).
+		PaddingTop(1).
+		PaddingLeft(4).
+		Width(m.width).
+		Render("Sleep timer is " +
+			components.Toggle(label, m.sleep.On) +
+			base.Foreground(t.Foreground).Faint(true).Render(" · the volume fades out over the last 30 seconds"))
+	listStyle := base.
+		Width(m.width).
+		Height(m.height).
+		MaxHeight(m.height). // a short terminal would push the status line under the now playing bar
+		PaddingLeft(2)
+	return base.Render(lipgloss.JoinVertical(0,
+		listStyle.Render(m.options.View()),
+		status,
+	))
+}
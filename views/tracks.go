@@ -48,11 +48,24 @@ var TracksMenu = struct {
 }{
 	Options: []string{
 		"Play",
+		"Play next",
 		"Add to queue",
 	},
 	prefix: "tracksMenu",
 }
 
+func handleTracksMenuOptionSelected(opt string) {
+	t := TracksMenu.selectedTrack
+	switch opt {
+	case "Play":
+		send(func() { daemon.PlayTrack(t) })
+	case "Play next":
+		send(func() { daemon.QueueNext(t) })
+	case "Add to queue":
+		send(func() { daemon.AddToQueue(t) })
+	}
+}
+
 func updateTracksMenuByReadingKeyboard(keyCode rune) {
 	switch keyCode {
 	case tea.KeyDown, 'j':
@@ -85,11 +98,8 @@ func (m TracksModel) Update(msg tea.Msg) (TracksModel, tea.Cmd) {
 					TracksMenu.selectedTrack = t.CustomData.(*daemon.Track)
 				}
 			} else {
-				opt := TracksMenu.Options[TracksMenu.selectedOption]
-				if opt == "Play" {
-					go daemon.PlayTrack(TracksMenu.selectedTrack)
-					m.showingMenu = false
-				}
+				handleTracksMenuOptionSelected(TracksMenu.Options[TracksMenu.selectedOption])
+				m.showingMenu = false
 			}
 			return m, nil
 		default:
@@ -105,6 +115,13 @@ func (m TracksModel) Update(msg tea.Msg) (TracksModel, tea.Cmd) {
 				m.showingMenu = false
 				TracksMenu.selectedTrack = &daemon.Track{}
 				TracksMenu.openedAt = image.Point{}
+			} else if m.showingMenu { // its inside, so do the action associated with the button
+				i := TracksMenu.selectedOption
+				if helpers.ZoneCollision(zone.Get(fmt.Sprint(TracksMenu.prefix, i)), msg) {
+					handleTracksMenuOptionSelected(TracksMenu.Options[i])
+					m.showingMenu = false
+				}
+				return m, nil
 			}
 		}
 		// open the modal for the clicked playlist
@@ -132,6 +149,12 @@ func (m TracksModel) Update(msg tea.Msg) (TracksModel, tea.Cmd) {
 	}
 	return m, cmd
 }
+
+// Searching reports whether the track list takes typed keys for its search query
+func (m TracksModel) Searching() bool {
+	return m.list.Searching()
+}
+
 func (m TracksModel) View() string {
 	var o string
 	t := themes.Active()
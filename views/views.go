@@ -6,11 +6,33 @@ type ViewMsg int
 
 const (
 	ViewPlaylists ViewMsg = iota
-	ViewTracks 
+	ViewTracks
 	ViewChangeTheme
+	ViewQueue
+	ViewEqualizer
+	ViewSleep
+	ViewVisualizer
 	ViewErrorLog
 )
 
+// daemonCalls runs the calls views make to the daemon one after the other.
+// The TUI shouldn't wait for the player manager to take them, but with a
+// goroutine each a quick second key press could overtake the first.
+var daemonCalls = make(chan func(), 64)
+
+func init() {
+	go func() {
+		for call := range daemonCalls {
+			call()
+		}
+	}()
+}
+
+// send queues a call to the daemon behind the ones made before it
+func send(call func()) {
+	daemonCalls <- call
+}
+
 func Goto(v ViewMsg) tea.Cmd {
 	return func() tea.Msg {
 		return v
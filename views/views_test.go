@@ -0,0 +1,21 @@
+package views
+
+import "testing"
+
+func TestSendKeepsOrder(t *testing.T) {
+	var got []int
+	done := make(chan struct{})
+	for i := range 1000 {
+		send(func() { got = append(got, i) })
+	}
+	send(func() { close(done) })
+	<-done
+	for i, n := range got {
+		if n != i {
+			t.Fatalf("call %d ran as call %d", n, i)
+		}
+	}
+	if len(got) != 1000 {
+		t.Fatalf("%d calls ran, want 1000", len(got))
+	}
+}
@@ -0,0 +1,98 @@
+package views
+
+import (
+	"strings"
+	"time"
+	daemon "ytt/YoutubeDaemon"
+	"ytt/themes"
+
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/charmbracelet/lipgloss/v2"
+)
+
+// visualizerFPS caps how often the spectrum is computed, no matter how
+// often the views are drawn
+const visualizerFPS = 30
+
+// how much of its height a bar drops every frame, bars rise right away
+const visualizerFall = 0.05
+
+// eighths of a cell, from empty to full
+var barBlocks = []rune(" ▁▂▃▄▅▆▇█")
+
+type VisualizerFrameMsg struct{}
+
+// VisualizerFrame schedules the next frame of the visualizer
+func VisualizerFrame() tea.Cmd {
+	return tea.Tick(time.Second/visualizerFPS, func(time.Time) tea.Msg {
+		return VisualizerFrameMsg{}
+	})
+}
+
+// VisualizerModel shows the spectrum of what is playing as bars. The
+// daemon keeps the audio for it in a tap that never blocks playback.
+type VisualizerModel struct {
+	bars, target  []float64 // heights from 0 to 1
+	playing       bool
+	width, height int
+}
+
+func Visualizer() VisualizerModel {
+	return VisualizerModel{}
+}
+
+func (m VisualizerModel) Update(msg tea.Msg) (VisualizerModel, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		// two columns per bar and one between them
+		n := max((m.width-2)/3, 1)
+		if n != len(m.bars) {
+			m.bars, m.target = make([]float64, n), make([]float64, n)
+		}
+	case daemon.EventStateChanged:
+		m.playing = msg.State == daemon.StatePlaying
+	case VisualizerFrameMsg:
+		if m.playing {
+			daemon.Spectrum(m.target)
+		} else {
+			clear(m.target) // the tap holds what played before pausing
+		}
+		for i, t := range m.target {
+			m.bars[i] = max(t, m.bars[i]-visualizerFall)
+		}
+	}
+	return m, nil
+}
+
+func (m VisualizerModel) View() string {
+	t := themes.Active()
+	base := lipgloss.NewStyle().
+		Background(t.Background)
+	bars := base.Foreground(themes.AccentColor())
+	rows := max(m.height-1, 1) // the last line is the legend
+
+	var lines []string
+	var row strings.Builder
+	for r := rows - 1; r >= 0; r-- {
+		row.Reset()
+		row.WriteString(" ")
+		for _, b := range m.bars {
+			eighths := int((b*float64(rows) - float64(r)) * 8)
+			block := barBlocks[max(0, min(eighths, 8))]
+			row.WriteRune(block)
+			row.WriteRune(block)
+			row.WriteRune(' ')
+		}
+		lines = append(lines, bars.Width(m.width).Render(row.String()))
+	}
+	legend := "40Hz"
+	high := "16kHz"
+	gap := max(len(m.bars)*3-len(legend)-len(high)-1, 1)
+	lines = append(lines, base.
+		Foreground(t.Foreground).
+		Faint(true).
+		Width(m.width).
+		Render(" "+legend+strings.Repeat(" ", gap)+high))
+	return strings.Join(lines, "\n")
+}